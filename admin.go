@@ -0,0 +1,58 @@
+package main
+
+import (
+    "crypto/subtle"
+    "net/http"
+
+    "go.uber.org/fx"
+)
+
+// AdminTokenHeader carries the shared secret that authorizes admin requests.
+const AdminTokenHeader = "X-Admin-Token"
+
+// NewShutdownHandler constructs the POST /admin/shutdown route, which stops
+// the application for a controlled restart. Fx provides an fx.Shutdowner to
+// every application; calling it unblocks app.Done() in main just like a
+// signal would.
+//
+// Requests must carry AppConfig.AdminToken in the X-Admin-Token header. When
+// no token is configured the route isn't registered at all.
+/*
+    NewShutdownHandler 构造POST /admin/shutdown路由，用于受控重启时停止应用程序。Fx为
+    每个应用程序提供fx.Shutdowner；调用它会像收到信号一样解除main中app.Done()的阻塞。
+
+    请求必须在X-Admin-Token头中携带AppConfig.AdminToken。未配置token时，该路由根本不
+    会被注册。
+*/
+func NewShutdownHandler(shutdowner fx.Shutdowner, cfg AppConfig, logger *LeveledLogger) RoutesResult {
+    if cfg.AdminToken == "" {
+        return RoutesResult{}
+    }
+    return RoutesResult{Routes: []Route{{
+        Path:   AdminPrefix + "shutdown",
+        Method: http.MethodPost,
+        Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if !validAdminToken(r, cfg.AdminToken) {
+                WriteProblem(w, http.StatusUnauthorized, "", "missing or invalid "+AdminTokenHeader)
+                return
+            }
+            logger.Warn("Shutdown requested via /admin/shutdown.")
+            // Answer first, so the client hears back before the server stops.
+            w.WriteHeader(http.StatusAccepted)
+            if f, ok := w.(http.Flusher); ok {
+                f.Flush()
+            }
+            go func() {
+                if err := shutdowner.Shutdown(); err != nil {
+                    logger.Errorf("Shutting down: %v", err)
+                }
+            }()
+        }),
+    }}}
+}
+
+// validAdminToken reports whether r carries token, comparing in constant time.
+func validAdminToken(r *http.Request, token string) bool {
+    got := r.Header.Get(AdminTokenHeader)
+    return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+    "context"
+    "sync"
+
+    "go.uber.org/fx"
+)
+
+// NewAppContext constructs a context that lives as long as the application:
+// it's a child of context.Background and is cancelled by an OnStop hook.
+// Constructors that spawn background goroutines should depend on it, so their
+// work stops when the application does.
+/*
+    NewAppContext 构造一个与应用程序生命周期相同的context：它是context.Background的
+    子context，并由OnStop hook取消。启动后台goroutine的构造函数应该依赖它，这样当应用
+    程序停止时，它们的工作也会停止。
+*/
+func NewAppContext(lc fx.Lifecycle) context.Context {
+    ctx, cancel := context.WithCancel(context.Background())
+    var once sync.Once
+    lc.Append(fx.Hook{
+        OnStop: func(context.Context) error {
+            once.Do(cancel)
+            return nil
+        },
+    })
+    return ctx
+}
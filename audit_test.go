@@ -0,0 +1,85 @@
+package main
+
+import (
+    "bytes"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "strings"
+    "testing"
+
+    "go.uber.org/fx/fxtest"
+)
+
+// auditHandler wraps an echoing handler in an AuditLogger built from cfg,
+// returning it with the buffer the audit log is written to.
+func auditHandler(t *testing.T, cfg AuditConfig) (http.Handler, *bytes.Buffer) {
+    t.Helper()
+    var buf bytes.Buffer
+    mcfg := NewMiddlewareConfig()
+    mcfg.Audit = cfg
+    a, err := NewAuditLogger(fxtest.NewLifecycle(t), mcfg, NewLoggerConfig(),
+        NewLeveledLogger(log.New(&buf, "", 0), NewLoggerConfig()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return a.route(Route{Path: "/echo", Audit: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+        io.Copy(w, r.Body)
+    })), &buf
+}
+
+func audit(h http.Handler, contentType, body string) {
+    req := httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body))
+    req.Header.Set("Content-Type", contentType)
+    h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAuditCapturesBodies(t *testing.T) {
+    h, buf := auditHandler(t, AuditConfig{})
+    audit(h, "text/plain", "ping")
+
+    if want := `POST /echo -> 200 request="ping" response="ping"`; !strings.Contains(buf.String(), want) {
+        t.Errorf("audit log = %q, want it to contain %q", buf.String(), want)
+    }
+}
+
+func TestAuditTruncatesLongBodies(t *testing.T) {
+    h, buf := auditHandler(t, AuditConfig{MaxBodyBytes: 4})
+    audit(h, "text/plain", "0123456789")
+
+    if want := `request="0123..." response="0123..."`; !strings.Contains(buf.String(), want) {
+        t.Errorf("audit log = %q, want it to contain %q", buf.String(), want)
+    }
+}
+
+func TestAuditRedacts(t *testing.T) {
+    tests := []struct {
+        name        string
+        contentType string
+        body        string
+        want        string
+    }{
+        {"JSON", "application/json", `{"user":"ann","password":"hunter2","nested":[{"Password":"x"}]}`,
+            `{"nested":[{"Password":"[REDACTED]"}],"password":"[REDACTED]","user":"ann"}`},
+        {"form", "application/x-www-form-urlencoded", "password=hunter2&user=ann",
+            "password=%5BREDACTED%5D&user=ann"},
+        {"unparseable", "text/plain", "password=hunter2 but not a form", "[31 bytes of text/plain]"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            h, buf := auditHandler(t, AuditConfig{Redact: []string{"(?i)^password$"}})
+            audit(h, tt.contentType, tt.body)
+
+            logged := buf.String()
+            if strings.Contains(logged, "hunter2") {
+                t.Errorf("audit log leaks the password: %q", logged)
+            }
+            if want := strings.Trim(strconv.Quote(tt.want), `"`); !strings.Contains(logged, want) {
+                t.Errorf("audit log = %q, want it to contain %q", logged, want)
+            }
+        })
+    }
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+)
+
+// DefaultBreakerResetTimeout is how long an open breaker waits before letting
+// a trial request through, unless BreakerConfig says otherwise.
+const DefaultBreakerResetTimeout = 30 * time.Second
+
+// BreakerConfig configures the circuit breaker on the shared HTTP client.
+/*
+    BreakerConfig 配置共享HTTP client上的熔断器。
+*/
+type BreakerConfig struct {
+    // FailureThreshold is the number of consecutive failures - transport
+    // errors or 5xx responses - that opens the breaker. Zero, the default,
+    // disables it.
+    FailureThreshold int `yaml:"failure_threshold"`
+    // ResetTimeout is how long the breaker stays open before it lets a single
+    // trial request through.
+    ResetTimeout time.Duration `yaml:"reset_timeout"`
+}
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState int
+
+const (
+    // BreakerClosed lets every request through, counting failures.
+    BreakerClosed BreakerState = iota
+    // BreakerOpen fails every request immediately with ErrBreakerOpen.
+    BreakerOpen
+    // BreakerHalfOpen lets one trial request through: its success closes the
+    // breaker, its failure opens it again.
+    BreakerHalfOpen
+)
+
+var breakerStateNames = [...]string{"closed", "open", "half-open"}
+
+func (s BreakerState) String() string {
+    if s < BreakerClosed || s > BreakerHalfOpen {
+        return fmt.Sprintf("BreakerState(%d)", int(s))
+    }
+    return breakerStateNames[s]
+}
+
+// ErrBreakerOpen is returned, wrapped, for requests the breaker refuses.
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker fails upstream calls fast once they've failed
+// FailureThreshold times in a row, instead of letting every request wait out
+// its timeout against an upstream that's down. After ResetTimeout it lets one
+// trial request through, and closes again if that succeeds. It wraps the
+// shared client's Transport (see NewHTTPClient), so every caller is
+// protected without doing anything.
+/*
+    CircuitBreaker 在上游调用连续失败FailureThreshold次后使其快速失败，而不是让每个请求
+    都对着已宕机的上游耗尽超时。ResetTimeout之后它放行一个试探请求，若成功则再次闭合。
+    它包装共享client的Transport（参见NewHTTPClient），因此所有调用方无需任何操作即受到
+    保护。
+*/
+type CircuitBreaker struct {
+    cfg    BreakerConfig
+    clock  Clock
+    logger *LeveledLogger
+
+    mu       sync.Mutex
+    state    BreakerState
+    failures int
+    openedAt time.Time
+    // trial is set while the half-open breaker's trial request is in flight.
+    trial bool
+}
+
+// NewCircuitBreaker constructs the breaker described by cfg.Breaker, timing
+// ResetTimeout with clock.
+func NewCircuitBreaker(cfg ClientConfig, clock Clock, logger *LeveledLogger) *CircuitBreaker {
+    b := &CircuitBreaker{cfg: cfg.Breaker, clock: clock, logger: logger}
+    if b.cfg.ResetTimeout <= 0 {
+        b.cfg.ResetTimeout = DefaultBreakerResetTimeout
+    }
+    return b
+}
+
+func (b *CircuitBreaker) enabled() bool {
+    return b.cfg.FailureThreshold > 0
+}
+
+// State returns the breaker's current state. An open breaker whose
+// ResetTimeout has passed still reports BreakerOpen until the next request
+// moves it to BreakerHalfOpen.
+func (b *CircuitBreaker) State() BreakerState {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.state
+}
+
+// allow reports whether a request may go ahead, moving an open breaker to
+// half-open once ResetTimeout has passed. trial marks the half-open
+// breaker's trial request, whose outcome alone decides what happens next;
+// the caller passes it back to record.
+func (b *CircuitBreaker) allow() (trial bool, err error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    switch b.state {
+    case BreakerOpen:
+        if since(b.clock, b.openedAt) < b.cfg.ResetTimeout {
+            return false, ErrBreakerOpen
+        }
+        b.state = BreakerHalfOpen
+        b.logger.Infof("Circuit breaker half-open, trying a request.")
+    case BreakerHalfOpen:
+        if b.trial {
+            return false, ErrBreakerOpen
+        }
+    case BreakerClosed:
+        return false, nil
+    }
+    b.trial = true
+    return true, nil
+}
+
+// record updates the breaker with the outcome of a request allow let through,
+// trial being what allow returned for it. A request the caller cancelled says
+// nothing about the upstream, so it neither counts as a failure nor as a
+// success. Nor does one let through before the breaker opened that finishes
+// after: only the trial's outcome moves the breaker out of half-open.
+func (b *CircuitBreaker) record(trial bool, req *http.Request, resp *http.Response, err error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if trial {
+        b.trial = false
+    }
+    if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+        return
+    }
+    if b.state != BreakerClosed && !trial {
+        return
+    }
+    if err == nil && resp.StatusCode < http.StatusInternalServerError {
+        if b.state != BreakerClosed {
+            b.logger.Infof("Circuit breaker closed.")
+        }
+        b.state, b.failures = BreakerClosed, 0
+        return
+    }
+    b.failures++
+    if trial || b.failures >= b.cfg.FailureThreshold {
+        b.state, b.openedAt = BreakerOpen, b.clock.Now()
+        b.logger.Warnf("Circuit breaker open after %d consecutive failure(s); retrying in %s.",
+            b.failures, b.cfg.ResetTimeout)
+    }
+}
+
+// RoundTripper returns next guarded by the breaker.
+func (b *CircuitBreaker) RoundTripper(next http.RoundTripper) http.RoundTripper {
+    return breakerTransport{b, next}
+}
+
+type breakerTransport struct {
+    breaker *CircuitBreaker
+    next    http.RoundTripper
+}
+
+func (t breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    trial, err := t.breaker.allow()
+    if err != nil {
+        return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Redacted(), err)
+    }
+    resp, err := t.next.RoundTrip(req)
+    t.breaker.record(trial, req, resp, err)
+    return resp, err
+}
+
+// CloseIdleConnections passes through to next, so http.Client's
+// CloseIdleConnections still reaches the pool.
+func (t breakerTransport) CloseIdleConnections() {
+    if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+        c.CloseIdleConnections()
+    }
+}
+
+// NewCircuitBreakerHandler constructs the /debug/breaker route, reporting
+// the breaker's state as JSON. Like the other debug routes, it's only
+// registered when AppConfig.EnablePprof is set, and then only if the breaker
+// is enabled. It's provided through OptionalRoute, as "breaker".
+/*
+    NewCircuitBreakerHandler 构造/debug/breaker路由，以JSON报告熔断器的状态。与其他
+    调试路由一样，只有在设置了AppConfig.EnablePprof时才会注册，并且要求熔断器已启用。它通过
+    OptionalRoute以"breaker"之名提供。
+*/
+func NewCircuitBreakerHandler(p DebugParams, b *CircuitBreaker) ([]Route, error) {
+    if !p.Config.EnablePprof || !b.enabled() {
+        return nil, nil
+    }
+    h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        b.mu.Lock()
+        out := struct {
+            State            string     `json:"state"`
+            Failures         int        `json:"failures"`
+            FailureThreshold int        `json:"failure_threshold"`
+            ResetTimeout     string     `json:"reset_timeout"`
+            OpenedAt         *time.Time `json:"opened_at,omitempty"`
+        }{
+            State:            b.state.String(),
+            Failures:         b.failures,
+            FailureThreshold: b.cfg.FailureThreshold,
+            ResetTimeout:     b.cfg.ResetTimeout.String(),
+        }
+        if b.state != BreakerClosed {
+            openedAt := b.openedAt
+            out.OpenedAt = &openedAt
+        }
+        b.mu.Unlock()
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(out)
+    })
+    return p.mount(Route{Path: "/debug/breaker", Handler: h})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper, standing in for an
+// upstream.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestBreakerTripsOnFailures(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    cfg := ClientConfig{Breaker: BreakerConfig{FailureThreshold: 3, ResetTimeout: time.Minute}}
+    b := NewCircuitBreaker(cfg, clock, discardLogger())
+    var calls atomic.Int32
+    var status atomic.Int32
+    status.Store(http.StatusBadGateway)
+    client := &http.Client{Transport: b.RoundTripper(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+        calls.Add(1)
+        return &http.Response{StatusCode: int(status.Load()), Body: http.NoBody, Request: req}, nil
+    }))}
+    get := func() error {
+        resp, err := client.Get("http://upstream.example.com/")
+        if err == nil {
+            resp.Body.Close()
+        }
+        return err
+    }
+
+    for i := 0; i < 3; i++ {
+        if err := get(); err != nil {
+            t.Fatalf("call %d: %v", i+1, err)
+        }
+    }
+    if got := b.State(); got != BreakerOpen {
+        t.Fatalf("after 3 failures the breaker is %s, want open", got)
+    }
+
+    if err := get(); !errors.Is(err, ErrBreakerOpen) {
+        t.Errorf("call through an open breaker: %v, want ErrBreakerOpen", err)
+    }
+    if got := calls.Load(); got != 3 {
+        t.Errorf("the upstream saw %d calls, want the open breaker to have held back the 4th", got)
+    }
+
+    // Once ResetTimeout passes, a successful trial closes the breaker.
+    clock.Advance(time.Minute)
+    status.Store(http.StatusOK)
+    if err := get(); err != nil {
+        t.Fatalf("trial call: %v", err)
+    }
+    if got := b.State(); got != BreakerClosed {
+        t.Errorf("after a successful trial the breaker is %s, want closed", got)
+    }
+}
+
+func TestBreakerReopensOnFailedTrial(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    cfg := ClientConfig{Breaker: BreakerConfig{FailureThreshold: 1, ResetTimeout: time.Minute}}
+    b := NewCircuitBreaker(cfg, clock, discardLogger())
+    client := &http.Client{Transport: b.RoundTripper(roundTripFunc(func(*http.Request) (*http.Response, error) {
+        return nil, errors.New("connection refused")
+    }))}
+
+    client.Get("http://upstream.example.com/")
+    if got := b.State(); got != BreakerOpen {
+        t.Fatalf("after a failure the breaker is %s, want open", got)
+    }
+    clock.Advance(time.Minute)
+    client.Get("http://upstream.example.com/")
+    if got := b.State(); got != BreakerOpen {
+        t.Errorf("after a failed trial the breaker is %s, want open again", got)
+    }
+    if _, err := client.Get("http://upstream.example.com/"); !errors.Is(err, ErrBreakerOpen) {
+        t.Errorf("call right after a failed trial: %v, want ErrBreakerOpen", err)
+    }
+}
+
+func TestBreakerIgnoresStragglersWhileHalfOpen(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    cfg := ClientConfig{Breaker: BreakerConfig{FailureThreshold: 1, ResetTimeout: time.Minute}}
+    b := NewCircuitBreaker(cfg, clock, discardLogger())
+    entered := make(chan string)
+    release := map[string]chan struct{}{"/slow-fail": make(chan struct{}), "/trial": make(chan struct{})}
+    rt := b.RoundTripper(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+        status := http.StatusOK
+        switch path := req.URL.Path; path {
+        case "/slow-cancel":
+            entered <- path
+            <-req.Context().Done()
+            return nil, req.Context().Err()
+        case "/slow-fail":
+            entered <- path
+            <-release[path]
+            status = http.StatusBadGateway
+        case "/trial":
+            entered <- path
+            <-release[path]
+        case "/fail":
+            status = http.StatusBadGateway
+        }
+        return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+    }))
+    call := func(ctx context.Context, path string) error {
+        req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://upstream.example.com"+path, nil)
+        _, err := rt.RoundTrip(req)
+        return err
+    }
+    background := func(ctx context.Context, path string) chan error {
+        done := make(chan error, 1)
+        go func() { done <- call(ctx, path) }()
+        if got := <-entered; got != path {
+            t.Fatalf("%s reached the upstream, want %s", got, path)
+        }
+        return done
+    }
+
+    // Two requests go out while the breaker is closed, and are still in
+    // flight when a third failure opens it.
+    ctx, cancel := context.WithCancel(t.Context())
+    cancelled := background(ctx, "/slow-cancel")
+    failed := background(t.Context(), "/slow-fail")
+    call(t.Context(), "/fail")
+    if got := b.State(); got != BreakerOpen {
+        t.Fatalf("after a failure the breaker is %s, want open", got)
+    }
+    clock.Advance(time.Minute)
+    trial := background(t.Context(), "/trial")
+
+    // The stragglers finish while the trial is in flight: neither frees the
+    // trial slot nor decides the trial's outcome.
+    cancel()
+    <-cancelled
+    if err := call(t.Context(), "/ok"); !errors.Is(err, ErrBreakerOpen) {
+        t.Errorf("call during the trial after a straggler was cancelled: %v, want ErrBreakerOpen", err)
+    }
+    close(release["/slow-fail"])
+    <-failed
+    if got := b.State(); got != BreakerHalfOpen {
+        t.Errorf("after a straggler failed during the trial the breaker is %s, want half-open", got)
+    }
+
+    close(release["/trial"])
+    if err := <-trial; err != nil {
+        t.Fatalf("trial call: %v", err)
+    }
+    if got := b.State(); got != BreakerClosed {
+        t.Errorf("after a successful trial the breaker is %s, want closed", got)
+    }
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "net/http"
+    "slices"
+    "strconv"
+    "sync"
+    "time"
+
+    "go.uber.org/fx"
+)
+
+// DefaultCacheTTL is how long a cached response stays fresh, unless
+// MiddlewareConfig.CacheTTL or Route.CacheTTL says otherwise.
+const DefaultCacheTTL = time.Minute
+
+// cacheSweepInterval is how often expired responses are dropped.
+const cacheSweepInterval = time.Minute
+
+// ResponseCache keeps responses to GET requests for routes flagged
+// Route.Cacheable, keyed by path and query, and serves them again until they
+// expire, with an Age header saying how old they are. Only 200 responses are
+// cached. Expired entries are dropped in the background until the
+// application context is cancelled.
+/*
+    ResponseCache 为标记了Route.Cacheable的路由保存GET请求的响应，以路径和查询为键，在
+    过期之前再次提供它们，并通过Age头说明其存在时间。只缓存200响应。过期的条目会在后台
+    被清除，直到应用程序context被取消。
+*/
+type ResponseCache struct {
+    clock Clock
+    ttl   time.Duration
+
+    mu      sync.Mutex
+    entries map[string]*cachedResponse
+}
+
+type cachedResponse struct {
+    header  http.Header
+    body    []byte
+    stored  time.Time
+    expires time.Time
+}
+
+// NewResponseCache constructs the cache, with MiddlewareConfig.CacheTTL as
+// the default TTL, and starts sweeping it when the application starts.
+func NewResponseCache(lc fx.Lifecycle, ctx context.Context, cfg MiddlewareConfig, clock Clock) *ResponseCache {
+    c := &ResponseCache{clock: clock, ttl: cfg.CacheTTL, entries: make(map[string]*cachedResponse)}
+    if c.ttl <= 0 {
+        c.ttl = DefaultCacheTTL
+    }
+    lc.Append(fx.Hook{
+        OnStart: func(context.Context) error {
+            go c.sweep(ctx, c.clock.NewTicker(cacheSweepInterval))
+            return nil
+        },
+    })
+    return c
+}
+
+// route caches next's responses for route.
+func (c *ResponseCache) route(route Route, next http.Handler) http.Handler {
+    ttl := route.CacheTTL
+    if ttl <= 0 {
+        ttl = c.ttl
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet {
+            next.ServeHTTP(w, r)
+            return
+        }
+        key := route.Server + " " + r.URL.RequestURI()
+        now := c.clock.Now()
+        if e, ok := c.get(key, now); ok {
+            for k, v := range e.header {
+                w.Header()[k] = slices.Clone(v)
+            }
+            w.Header().Set("Age", strconv.Itoa(int(now.Sub(e.stored).Seconds())))
+            w.WriteHeader(http.StatusOK)
+            w.Write(e.body)
+            return
+        }
+
+        // Only the headers the handler sets belong to the response; the
+        // ones middleware set further out (the request ID, say) are
+        // per-request.
+        before := w.Header().Clone()
+        rec := &cacheRecorder{statusRecorder: newStatusRecorder(w)}
+        next.ServeHTTP(rec, r)
+        if rec.Status != http.StatusOK {
+            return
+        }
+        header := make(http.Header)
+        for k, v := range w.Header() {
+            if !slices.Equal(before[k], v) {
+                header[k] = slices.Clone(v)
+            }
+        }
+        c.mu.Lock()
+        c.entries[key] = &cachedResponse{header: header, body: rec.body.Bytes(), stored: now, expires: now.Add(ttl)}
+        c.mu.Unlock()
+    })
+}
+
+// get returns the fresh entry for key, if there is one.
+func (c *ResponseCache) get(key string, now time.Time) (*cachedResponse, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    e, ok := c.entries[key]
+    if !ok || !now.Before(e.expires) {
+        return nil, false
+    }
+    return e, true
+}
+
+// sweep drops expired entries each time ticker fires, until ctx is done. The
+// ticker comes from the cache's Clock, made before sweep is started so a test
+// advancing a FakeClock can count on it.
+func (c *ResponseCache) sweep(ctx context.Context, ticker Ticker) {
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C():
+            now := c.clock.Now()
+            c.mu.Lock()
+            for key, e := range c.entries {
+                if !now.Before(e.expires) {
+                    delete(c.entries, key)
+                }
+            }
+            c.mu.Unlock()
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// cacheRecorder is a statusRecorder that also keeps a copy of the body the
+// handler writes. Flushing, hijacking and Unwrap come with the statusRecorder.
+type cacheRecorder struct {
+    *statusRecorder
+    body bytes.Buffer
+}
+
+func (r *cacheRecorder) Write(b []byte) (int, error) {
+    n, err := r.statusRecorder.Write(b)
+    r.body.Write(b[:n])
+    return n, err
+}
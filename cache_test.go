@@ -0,0 +1,108 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "slices"
+    "testing"
+    "time"
+
+    "go.uber.org/fx/fxtest"
+)
+
+func TestResponseCacheHitMissAndExpiry(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    cfg := NewMiddlewareConfig()
+    cfg.CacheTTL = time.Minute
+    c := NewResponseCache(fxtest.NewLifecycle(t), t.Context(), cfg, clock)
+    calls := 0
+    h := c.route(Route{Path: "/count", Cacheable: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls++
+        w.Header().Set("X-Call", fmt.Sprint(calls))
+        fmt.Fprintf(w, "call %d", calls)
+    }))
+    get := func(target string) *httptest.ResponseRecorder {
+        t.Helper()
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+        return rec
+    }
+
+    if rec := get("/count"); rec.Body.String() != "call 1" || rec.Header().Get("Age") != "" {
+        t.Errorf("first GET = %q with Age %q, want a fresh response", rec.Body.String(), rec.Header().Get("Age"))
+    }
+    clock.Advance(30 * time.Second)
+    rec := get("/count")
+    if rec.Body.String() != "call 1" || rec.Header().Get("X-Call") != "1" {
+        t.Errorf("GET within the TTL = %q, X-Call %q, want the cached call 1", rec.Body.String(), rec.Header().Get("X-Call"))
+    }
+    if age := rec.Header().Get("Age"); age != "30" {
+        t.Errorf("cached response's Age = %q, want \"30\"", age)
+    }
+    // The query is part of the key.
+    if rec := get("/count?page=2"); rec.Body.String() != "call 2" {
+        t.Errorf("GET with another query = %q, want a miss", rec.Body.String())
+    }
+    clock.Advance(30 * time.Second)
+    if rec := get("/count"); rec.Body.String() != "call 3" || rec.Header().Get("Age") != "" {
+        t.Errorf("GET after the TTL = %q with Age %q, want a fresh response", rec.Body.String(), rec.Header().Get("Age"))
+    }
+}
+
+func TestResponseCacheSkipsErrors(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    c := NewResponseCache(fxtest.NewLifecycle(t), t.Context(), NewMiddlewareConfig(), clock)
+    calls := 0
+    h := c.route(Route{Path: "/flaky", Cacheable: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls++
+        http.Error(w, "unavailable", http.StatusServiceUnavailable)
+    }))
+    for range 2 {
+        h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/flaky", nil))
+    }
+    if calls != 2 {
+        t.Errorf("handler called %d times, want 2: a 503 shouldn't be cached", calls)
+    }
+}
+
+func TestResponseCacheSweepsExpiredEntries(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    lc := fxtest.NewLifecycle(t)
+    c := NewResponseCache(lc, t.Context(), NewMiddlewareConfig(), clock)
+    lc.RequireStart()
+    defer lc.RequireStop()
+    ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+    for path, ttl := range map[string]time.Duration{"/short": 30 * time.Second, "/long": 5 * time.Minute} {
+        c.route(Route{Path: path, Cacheable: true, CacheTTL: ttl}, ok).
+            ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+    }
+    cached := func() []string {
+        c.mu.Lock()
+        defer c.mu.Unlock()
+        var keys []string
+        for key := range c.entries {
+            keys = append(keys, key)
+        }
+        slices.Sort(keys)
+        return keys
+    }
+    waitForEntries := func(want ...string) {
+        t.Helper()
+        deadline := time.Now().Add(5 * time.Second)
+        for !slices.Equal(cached(), want) {
+            if time.Now().After(deadline) {
+                t.Fatalf("cache holds %q, want %q", cached(), want)
+            }
+            time.Sleep(time.Millisecond)
+        }
+    }
+    waitForEntries(" /long", " /short")
+
+    clock.Advance(cacheSweepInterval)
+    waitForEntries(" /long")
+    for range 4 {
+        clock.Advance(cacheSweepInterval)
+    }
+    waitForEntries()
+}
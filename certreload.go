@@ -0,0 +1,88 @@
+package main
+
+import (
+    "crypto/tls"
+    "fmt"
+    "sync"
+    "sync/atomic"
+)
+
+// certReloader serves a TLS certificate loaded from disk, and can reload it
+// while the server is running, so a rotated certificate takes effect without
+// a restart. The parsed certificate is swapped atomically: handshakes in
+// progress keep the one they started with.
+type certReloader struct {
+    certFile, keyFile string
+    cert              atomic.Pointer[tls.Certificate]
+}
+
+// newCertReloader loads the certificate and key pair, failing if they can't
+// be read.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+    r := &certReloader{certFile: certFile, keyFile: keyFile}
+    if err := r.reload(); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+// reload re-reads the certificate and key pair. On failure the current
+// certificate stays in use.
+func (r *certReloader) reload() error {
+    cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+    if err != nil {
+        return fmt.Errorf("loading TLS certificate %q and key %q: %w", r.certFile, r.keyFile, err)
+    }
+    r.cert.Store(&cert)
+    return nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate callback returning the
+// current certificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    return r.cert.Load(), nil
+}
+
+// ReloadHooks collects the things to reload alongside the configuration when
+// SignalHandler receives SIGHUP - TLS certificates, for instance. Components
+// register a hook when they have something to reload; SignalHandler runs them
+// all in registration order.
+/*
+    ReloadHooks 收集SignalHandler收到SIGHUP时需要与配置一起重新加载的内容，例如TLS证书。
+    组件在有需要重新加载的内容时注册一个hook；SignalHandler按注册顺序运行所有hook。
+*/
+type ReloadHooks struct {
+    mu    sync.Mutex
+    hooks []reloadHook
+}
+
+type reloadHook struct {
+    name   string
+    reload func() error
+}
+
+// NewReloadHooks constructs an empty ReloadHooks.
+func NewReloadHooks() *ReloadHooks {
+    return &ReloadHooks{}
+}
+
+// Add registers reload under name, which identifies it in logs.
+func (h *ReloadHooks) Add(name string, reload func() error) {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.hooks = append(h.hooks, reloadHook{name, reload})
+}
+
+// run calls every hook, logging whether each succeeded.
+func (h *ReloadHooks) run(logger *LeveledLogger) {
+    h.mu.Lock()
+    hooks := append([]reloadHook(nil), h.hooks...)
+    h.mu.Unlock()
+    for _, hook := range hooks {
+        if err := hook.reload(); err != nil {
+            logger.Errorf("Reloading %s: %v", hook.name, err)
+            continue
+        }
+        logger.Infof("Reloaded %s.", hook.name)
+    }
+}
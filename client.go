@@ -0,0 +1,224 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "io"
+    "net"
+    "net/http"
+    "time"
+
+    "go.opentelemetry.io/otel/trace"
+    "go.uber.org/fx"
+)
+
+// Defaults applied by NewClientConfig.
+const (
+    DefaultClientTimeout       = 30 * time.Second
+    DefaultDialTimeout         = 10 * time.Second
+    DefaultKeepAlive           = 30 * time.Second
+    DefaultMaxIdleConns        = 100
+    DefaultMaxIdleConnsPerHost = 10
+    DefaultClientIdleTimeout   = 90 * time.Second
+)
+
+// ClientConfig holds the settings NewHTTPClient uses for outbound requests.
+/*
+    ClientConfig 保存NewHTTPClient用于出站请求的设置。
+*/
+type ClientConfig struct {
+    // Timeout bounds each request end to end, including reading the body.
+    // Zero means no limit, as in net/http.
+    Timeout time.Duration `yaml:"timeout"`
+    // DialTimeout bounds establishing a connection, and KeepAlive is the TCP
+    // keep-alive period of each connection.
+    DialTimeout time.Duration `yaml:"dial_timeout"`
+    KeepAlive   time.Duration `yaml:"keep_alive"`
+    // MaxIdleConns and MaxIdleConnsPerHost size the connection pool, and
+    // IdleConnTimeout is how long an unused pooled connection is kept.
+    MaxIdleConns        int           `yaml:"max_idle_conns"`
+    MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+    IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout"`
+    // UpstreamURL is fetched by the GET /upstream sample route, which isn't
+    // registered when it's empty.
+    UpstreamURL string `yaml:"upstream_url"`
+    // Breaker configures the circuit breaker around the client's transport.
+    Breaker BreakerConfig `yaml:"breaker"`
+}
+
+// NewClientConfig constructs the default ClientConfig.
+func NewClientConfig() ClientConfig {
+    return ClientConfig{
+        Timeout:             DefaultClientTimeout,
+        DialTimeout:         DefaultDialTimeout,
+        KeepAlive:           DefaultKeepAlive,
+        MaxIdleConns:        DefaultMaxIdleConns,
+        MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+        IdleConnTimeout:     DefaultClientIdleTimeout,
+        Breaker:             BreakerConfig{ResetTimeout: DefaultBreakerResetTimeout},
+    }
+}
+
+// TransportWrapper wraps the HTTP client's transport with another
+// http.RoundTripper - one that traces, retries or records requests, say.
+// NewHTTPClient applies it when one is provided. A test can ignore next
+// altogether and answer every request itself:
+//
+//   fx.Provide(func() TransportWrapper {
+//       return func(http.RoundTripper) http.RoundTripper { return fakeUpstream }
+//   }),
+/*
+    TransportWrapper 用另一个http.RoundTripper（例如进行追踪、重试或记录请求的）包装HTTP
+    client的transport。提供了它时，NewHTTPClient会应用它。测试可以完全忽略next，自己
+    应答每个请求（示例见上）。
+*/
+type TransportWrapper func(next http.RoundTripper) http.RoundTripper
+
+// ClientParams are NewHTTPClient's dependencies. Wrap and Tracer are
+// optional; TracingModule provides the latter.
+/*
+    ClientParams 是NewHTTPClient的依赖项。Wrap和Tracer是可选的；TracingModule提供后者。
+*/
+type ClientParams struct {
+    fx.In
+
+    Lifecycle fx.Lifecycle
+    Config    ClientConfig
+    Breaker   *CircuitBreaker
+    Wrap      TransportWrapper     `optional:"true"`
+    Tracer    trace.TracerProvider `optional:"true"`
+}
+
+// NewHTTPClient constructs the *http.Client handlers use to call other
+// services. http.DefaultClient has no timeout at all, so a slow upstream can
+// hold a request - and its goroutine - forever; this one is bounded, and its
+// connection pool is sized from ClientConfig. Every handler that takes a
+// *http.Client shares the one pool, and the OnStop hook closes its idle
+// connections.
+//
+// The transport is built up from the inside out:
+//
+//   1. a clone of http.DefaultTransport with the configured pool settings;
+//   2. the TransportWrapper, if one is provided (tracing, retries, a mock);
+//   3. the circuit breaker, if it's enabled;
+//   4. a client span carrying the trace context on in the traceparent header,
+//      if there's a TracerProvider.
+//
+// So the breaker sees one outcome per call, after any retries the wrapper
+// makes, and while it's open, calls fail before reaching the wrapper at all;
+// the span covers the whole call, a breaker rejection included.
+/*
+    NewHTTPClient 构造handler调用其他服务时使用的*http.Client。http.DefaultClient完全
+    没有超时，因此一个缓慢的上游可能永远占用一个请求及其goroutine；这个client是有界的，
+    其连接池的大小来自ClientConfig。所有接收*http.Client的handler共享同一个连接池，
+    OnStop hook会关闭其空闲连接。
+
+    transport由内向外构建：
+
+      1. 使用配置的连接池设置克隆的http.DefaultTransport；
+      2. TransportWrapper（如果提供了的话，例如追踪、重试或mock）；
+      3. 熔断器（如果启用了的话）；
+      4. 在traceparent头中继续传递trace context的客户端span（如果有TracerProvider的话）。
+
+    因此熔断器对每次调用只看到一个结果（在wrapper的重试之后），而当它打开时，调用根本
+    不会到达wrapper就会失败；span覆盖整个调用，包括熔断器的拒绝。
+*/
+func NewHTTPClient(p ClientParams) *http.Client {
+    cfg := p.Config
+    dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.DialContext = dialer.DialContext
+    transport.MaxIdleConns = cfg.MaxIdleConns
+    transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+    transport.IdleConnTimeout = cfg.IdleConnTimeout
+    var rt http.RoundTripper = transport
+    if p.Wrap != nil {
+        rt = p.Wrap(rt)
+    }
+    if p.Breaker.enabled() {
+        rt = p.Breaker.RoundTripper(rt)
+    }
+    if p.Tracer != nil {
+        rt = traceCalls(rt, p.Tracer.Tracer(tracerName))
+    }
+    client := &http.Client{Transport: rt, Timeout: cfg.Timeout}
+    p.Lifecycle.Append(fx.Hook{
+        OnStop: func(context.Context) error {
+            // Close the pool directly: a wrapper needn't pass
+            // CloseIdleConnections through.
+            transport.CloseIdleConnections()
+            return nil
+        },
+    })
+    return client
+}
+
+// Client wraps the shared *http.Client with helpers for calls made while
+// serving a request.
+/*
+    Client 包装共享的*http.Client，提供在处理请求期间发起调用的辅助方法。
+*/
+type Client struct {
+    *http.Client
+}
+
+// NewClient wraps client.
+func NewClient(client *http.Client) *Client {
+    return &Client{Client: client}
+}
+
+// DoWithContext makes a GET request to url on behalf of the inbound request
+// r. The outbound request carries r's context, so it's cancelled when the
+// caller disconnects or the server stops, and can't outlive r's deadline
+// (from MiddlewareConfig.RequestTimeout, say). It also forwards r's request
+// ID, if there is one, so the two requests can be matched up in logs.
+/*
+    DoWithContext 代表入站请求r向url发起GET请求。出站请求携带r的context，因此在调用方
+    断开连接或服务器停止时会被取消，并且不会超过r的截止时间（例如来自
+    MiddlewareConfig.RequestTimeout）。如果r带有请求ID，也会一并转发，以便在日志中对应
+    两个请求。
+*/
+func (c *Client) DoWithContext(r *http.Request, url string) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+    if err != nil {
+        return nil, err
+    }
+    if id, ok := RequestIDFrom(r.Context()); ok {
+        req.Header.Set(RequestIDHeader, id)
+    }
+    return c.Do(req)
+}
+
+// NewUpstreamHandler constructs GET /upstream, a sample route that fetches
+// ClientConfig.UpstreamURL with DoWithContext and relays the response. If
+// the caller gives up first, the upstream call is abandoned with it.
+/*
+    NewUpstreamHandler 构造GET /upstream示例路由，它使用DoWithContext获取
+    ClientConfig.UpstreamURL并转发响应。如果调用方先放弃，上游调用也随之放弃。
+*/
+func NewUpstreamHandler(cfg ClientConfig, client *Client, logger *LeveledLogger) RoutesResult {
+    if cfg.UpstreamURL == "" {
+        return RoutesResult{}
+    }
+    h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        resp, err := client.DoWithContext(r, cfg.UpstreamURL)
+        if err != nil {
+            if errors.Is(err, context.Canceled) {
+                logger.Debugf("Upstream call abandoned: %v", err)
+                return
+            }
+            logger.Warnf("Calling upstream %s: %v", cfg.UpstreamURL, err)
+            WriteProblem(w, http.StatusBadGateway, "", "the upstream call failed")
+            return
+        }
+        defer resp.Body.Close()
+        if ct := resp.Header.Get("Content-Type"); ct != "" {
+            w.Header().Set("Content-Type", ct)
+        }
+        w.WriteHeader(resp.StatusCode)
+        if _, err := io.Copy(w, resp.Body); err != nil {
+            logger.Debugf("Relaying upstream response: %v", err)
+        }
+    })
+    return RoutesResult{Routes: []Route{{Path: "/upstream", Method: http.MethodGet, Handler: h}}}
+}
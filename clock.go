@@ -0,0 +1,157 @@
+package main
+
+import (
+    "sync"
+    "time"
+)
+
+// Clock tells the time. Code that measures durations - request latency, the
+// access log - or runs on a schedule, like the Scheduler, takes a Clock
+// instead of calling time.Now or time.NewTicker directly, so tests can
+// control what it sees.
+//
+// The application gets the real clock from NewClock; a test swaps in a
+// FakeClock with fx.Decorate:
+//
+//   clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+//   app := fxtest.New(t,
+//       HTTPModule,
+//       fx.Decorate(func(Clock) Clock { return clock }),
+//   )
+/*
+    Clock 用于获取时间。测量时长的代码（请求延迟、访问日志）或按计划运行的代码（如
+    Scheduler）接收一个Clock，而不是直接调用time.Now或time.NewTicker，这样测试就可以
+    控制它看到的时间。
+
+    应用程序从NewClock获得真实时钟；测试通过fx.Decorate替换为FakeClock（示例见上）。
+*/
+type Clock interface {
+    Now() time.Time
+    NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the part of *time.Ticker a Clock hands out: a channel that
+// delivers the time every period, and a way to stop it.
+type Ticker interface {
+    C() <-chan time.Time
+    Stop()
+}
+
+// NewClock constructs the real, wall-clock Clock.
+func NewClock() Clock {
+    return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+    return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// since is time.Since for an injected Clock.
+func since(c Clock, t time.Time) time.Duration {
+    return c.Now().Sub(t)
+}
+
+// FakeClock is a Clock for tests. Its time only moves when Advance or Set is
+// called, and its tickers only fire then. It's safe for concurrent use.
+/*
+    FakeClock 是供测试使用的Clock。只有调用Advance或Set时它的时间才会变化，它的ticker
+    也只在那时触发。它可以安全地并发使用。
+*/
+type FakeClock struct {
+    mu      sync.Mutex
+    now     time.Time
+    tickers []*fakeTicker
+}
+
+// NewFakeClock constructs a FakeClock stopped at now.
+func NewFakeClock(now time.Time) *FakeClock {
+    return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.now
+}
+
+// NewTicker returns a Ticker that fires as Advance or Set carry the clock
+// past each period. Like a *time.Ticker, it drops ticks nobody is ready to
+// receive.
+func (c *FakeClock) NewTicker(d time.Duration) Ticker {
+    if d <= 0 {
+        panic("non-positive interval for FakeClock.NewTicker")
+    }
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    t := &fakeTicker{clock: c, period: d, next: c.now.Add(d), c: make(chan time.Time, 1)}
+    c.tickers = append(c.tickers, t)
+    return t
+}
+
+// Tickers returns how many tickers are running, so a test can wait for the
+// code under test to create one before advancing the clock.
+func (c *FakeClock) Tickers() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return len(c.tickers)
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.set(c.now.Add(d))
+}
+
+// Set moves the clock to t.
+func (c *FakeClock) Set(t time.Time) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.set(t)
+}
+
+// set moves the clock to t and fires the tickers that came due. c.mu must be
+// held.
+func (c *FakeClock) set(t time.Time) {
+    c.now = t
+    for _, tk := range c.tickers {
+        if t.Before(tk.next) {
+            continue
+        }
+        select {
+        case tk.c <- t:
+        default:
+        }
+        for !t.Before(tk.next) {
+            tk.next = tk.next.Add(tk.period)
+        }
+    }
+}
+
+type fakeTicker struct {
+    clock  *FakeClock
+    period time.Duration
+    next   time.Time
+    c      chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t *fakeTicker) Stop() {
+    t.clock.mu.Lock()
+    defer t.clock.mu.Unlock()
+    for i, tk := range t.clock.tickers {
+        if tk == t {
+            t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+            return
+        }
+    }
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// ConcurrencyConfig caps how many requests are handled at once, protecting
+// whatever sits behind the handlers (a database pool, an upstream) from
+// more load than it can take. A zero Max disables the cap.
+/*
+    ConcurrencyConfig 限制同时处理的请求数，保护handlers背后的资源（数据库连接池、上游
+    服务）免受超出其承受能力的负载。Max为零时禁用该限制。
+*/
+type ConcurrencyConfig struct {
+    // Max is the number of requests that may be in progress at once.
+    Max int `yaml:"max"`
+    // Wait is how long a request over the limit waits for a slot before it
+    // gets a 503. Zero rejects it immediately.
+    Wait time.Duration `yaml:"wait"`
+}
+
+// ConcurrencyLimiter holds the semaphore shared by every route, plus one for
+// each route that sets Route.MaxConcurrent.
+/*
+    ConcurrencyLimiter 持有所有路由共享的信号量，以及每个设置了Route.MaxConcurrent的
+    路由各自的信号量。
+*/
+type ConcurrencyLimiter struct {
+    shared *semaphore
+    wait   time.Duration
+
+    mu     sync.Mutex
+    routes map[string]*semaphore
+}
+
+// semaphore is a counting semaphore that keeps score of its rejections.
+type semaphore struct {
+    slots    chan struct{}
+    rejected atomic.Int64
+}
+
+func newSemaphore(n int) *semaphore {
+    return &semaphore{slots: make(chan struct{}, n)}
+}
+
+// NewConcurrencyLimiter constructs the limiter described by
+// MiddlewareConfig.Concurrency.
+func NewConcurrencyLimiter(cfg MiddlewareConfig) *ConcurrencyLimiter {
+    l := &ConcurrencyLimiter{wait: cfg.Concurrency.Wait, routes: make(map[string]*semaphore)}
+    if cfg.Concurrency.Max > 0 {
+        l.shared = newSemaphore(cfg.Concurrency.Max)
+    }
+    return l
+}
+
+// NewConcurrencyLimitMiddleware contributes the middleware enforcing the
+// shared limit, if MiddlewareConfig.Concurrency sets one. It wraps just
+// inside the in-flight counter, so rejected requests are cheap but still
+// counted.
+/*
+    NewConcurrencyLimitMiddleware 提供执行共享限制的中间件（如果
+    MiddlewareConfig.Concurrency设置了限制）。它紧挨在in-flight计数器内侧，因此被拒绝的
+    请求开销很小，但仍会被计数。
+*/
+func NewConcurrencyLimitMiddleware(l *ConcurrencyLimiter) MiddlewareResult {
+    m := Middleware{Name: "concurrency-limit", Priority: PriorityConcurrency}
+    if l.shared != nil {
+        m.Wrap = func(next http.Handler) http.Handler { return l.limit(next, l.shared) }
+    }
+    return MiddlewareResult{Middleware: m}
+}
+
+// route returns next limited to max concurrent requests of its own, on top
+// of the shared limit. route identifies it on the debug route.
+func (l *ConcurrencyLimiter) route(route string, max int, next http.Handler) http.Handler {
+    s := newSemaphore(max)
+    l.mu.Lock()
+    l.routes[route] = s
+    l.mu.Unlock()
+    return l.limit(next, s)
+}
+
+// limit serves each request to next once it holds a slot in s, answering
+// 503 if none frees up within the configured wait.
+func (l *ConcurrencyLimiter) limit(next http.Handler, s *semaphore) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !l.acquire(r.Context(), s) {
+            s.rejected.Add(1)
+            w.Header().Set("Retry-After", "1")
+            WriteProblem(w, http.StatusServiceUnavailable, "", "too many concurrent requests")
+            return
+        }
+        defer func() { <-s.slots }()
+        next.ServeHTTP(w, r)
+    })
+}
+
+// acquire takes a slot in s, waiting up to l.wait for one to free up.
+func (l *ConcurrencyLimiter) acquire(ctx context.Context, s *semaphore) bool {
+    select {
+    case s.slots <- struct{}{}:
+        return true
+    default:
+    }
+    if l.wait <= 0 {
+        return false
+    }
+    timer := time.NewTimer(l.wait)
+    defer timer.Stop()
+    select {
+    case s.slots <- struct{}{}:
+        return true
+    case <-timer.C:
+        return false
+    case <-ctx.Done():
+        return false
+    }
+}
+
+type concurrencyStats struct {
+    InUse    int   `json:"in_use"`
+    Max      int   `json:"max"`
+    Rejected int64 `json:"rejected"`
+}
+
+func (s *semaphore) stats() concurrencyStats {
+    return concurrencyStats{InUse: len(s.slots), Max: cap(s.slots), Rejected: s.rejected.Load()}
+}
+
+// NewConcurrencyHandler constructs the /debug/concurrency route, reporting
+// the requests in progress, the limit and the number rejected, for the
+// shared limit and each route with its own. Like the other debug routes,
+// it's only registered when AppConfig.EnablePprof is set, and it's provided
+// through OptionalRoute, as "concurrency".
+/*
+    NewConcurrencyHandler 构造/debug/concurrency路由，报告共享限制以及每个拥有自己限制的
+    路由的进行中请求数、上限和被拒绝的数量。与其他调试路由一样，只有在设置了
+    AppConfig.EnablePprof时才会注册，并通过OptionalRoute以"concurrency"之名提供。
+*/
+func NewConcurrencyHandler(p DebugParams, l *ConcurrencyLimiter) ([]Route, error) {
+    if !p.Config.EnablePprof {
+        return nil, nil
+    }
+    h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        var out struct {
+            Shared *concurrencyStats           `json:"shared,omitempty"`
+            Routes map[string]concurrencyStats `json:"routes,omitempty"`
+        }
+        if l.shared != nil {
+            stats := l.shared.stats()
+            out.Shared = &stats
+        }
+        l.mu.Lock()
+        out.Routes = make(map[string]concurrencyStats, len(l.routes))
+        for route, s := range l.routes {
+            out.Routes[route] = s.stats()
+        }
+        l.mu.Unlock()
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(out)
+    })
+    return p.mount(Route{Path: "/debug/concurrency", Handler: h})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+)
+
+func TestConcurrencyLimitPastTheLimit(t *testing.T) {
+    cfg := NewMiddlewareConfig()
+    cfg.Concurrency = ConcurrencyConfig{Max: 2}
+    l := NewConcurrencyLimiter(cfg)
+    entered := make(chan struct{})
+    release := make(chan struct{})
+    h := NewConcurrencyLimitMiddleware(l).Middleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        entered <- struct{}{}
+        <-release
+        w.WriteHeader(http.StatusOK)
+    }))
+    serve := func() int {
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+        return rec.Code
+    }
+
+    // Fill both slots, then drive more requests at the limit while they're
+    // held.
+    codes := make(chan int, 2)
+    var wg sync.WaitGroup
+    for i := 0; i < 2; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            codes <- serve()
+        }()
+        <-entered
+    }
+    const extra = 5
+    var rejected sync.WaitGroup
+    for i := 0; i < extra; i++ {
+        rejected.Add(1)
+        go func() {
+            defer rejected.Done()
+            if code := serve(); code != http.StatusServiceUnavailable {
+                t.Errorf("request past the limit got %d, want 503", code)
+            }
+        }()
+    }
+    rejected.Wait()
+    if got := l.shared.stats(); got.InUse != 2 || got.Rejected != extra {
+        t.Errorf("stats = %+v, want 2 in use and %d rejected", got, extra)
+    }
+
+    close(release)
+    wg.Wait()
+    close(codes)
+    for code := range codes {
+        if code != http.StatusOK {
+            t.Errorf("request within the limit got %d, want 200", code)
+        }
+    }
+    go func() { <-entered }()
+    if code := serve(); code != http.StatusOK {
+        t.Errorf("request once the slots freed up got %d, want 200", code)
+    }
+}
+
+func TestConcurrencyLimitPerRoute(t *testing.T) {
+    l := NewConcurrencyLimiter(NewMiddlewareConfig())
+    release := make(chan struct{})
+    entered := make(chan struct{})
+    h := l.route("GET /slow", 1, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        close(entered)
+        <-release
+    }))
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+    }()
+    <-entered
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slow", nil))
+    if rec.Code != http.StatusServiceUnavailable {
+        t.Errorf("second request to a route capped at 1 got %d, want 503", rec.Code)
+    }
+    close(release)
+    <-done
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+    "crypto/tls"
+    "errors"
+    "fmt"
+    "io/fs"
+    "net"
+    "os"
+    "regexp"
+    "strings"
+    "time"
+
+    "go.uber.org/fx"
+    "gopkg.in/yaml.v3"
+)
+
+// DefaultGreeting is the message NewHandler responds with when AppConfig
+// doesn't set one.
+const DefaultGreeting = "hello"
+
+// DefaultConfigPath is the file NewConfig reads when CONFIG_PATH is unset.
+const DefaultConfigPath = "config.yaml"
+
+// Default application start and stop timeouts, matching Fx's own defaults.
+const (
+    DefaultStartTimeout = 15 * time.Second
+    DefaultStopTimeout  = 15 * time.Second
+)
+
+// AppConfig is the application's configuration, as loaded by NewConfig. It
+// holds application-level settings directly and each component's settings in
+// a nested struct; NewComponentConfigs hands those to the components, so
+// NewMux and NewLogger never need to know where their configuration came from.
+/*
+    AppConfig 是由NewConfig加载的应用程序配置。它直接保存应用程序级的设置，并将每个
+    组件的设置保存在嵌套结构体中；NewComponentConfigs将这些设置交给各个组件，因此
+    NewMux和NewLogger永远不需要知道它们的配置从何而来。
+*/
+type AppConfig struct {
+    // Greeting is the message NewHandler includes in its responses.
+    Greeting string `yaml:"greeting"`
+
+    // StaticDir is a directory to serve under /static/. Empty disables it.
+    StaticDir string `yaml:"static_dir"`
+
+    // StartTimeout and StopTimeout bound how long the application may take
+    // to start and stop, including every Lifecycle hook.
+    StartTimeout time.Duration `yaml:"start_timeout"`
+    StopTimeout  time.Duration `yaml:"stop_timeout"`
+
+    // Workers is the number of goroutines in the WorkerPool.
+    Workers int `yaml:"workers"`
+
+    // JobOverrun decides what's logged when a scheduled Job is still running
+    // when its next run is due: JobOverrunSkip (the default) or
+    // JobOverrunWarn. Either way that run is skipped.
+    JobOverrun string `yaml:"job_overrun"`
+
+    // EnablePprof exposes the net/http/pprof endpoints under /debug/pprof/,
+    // along with the other debug routes such as /debug/echo.
+    EnablePprof bool `yaml:"enable_pprof"`
+    // DebugServer names the server (see NamedServer) debug routes are
+    // mounted on. Empty means the main server.
+    DebugServer string `yaml:"debug_server"`
+
+    // AdminToken is the shared secret admin routes such as /admin/shutdown
+    // require in the X-Admin-Token header. Empty disables those routes.
+    AdminToken string `yaml:"admin_token"`
+
+    // RandomSeed seeds NewRandom, making request IDs reproducible. Zero, the
+    // default, seeds from the current time.
+    RandomSeed int64 `yaml:"random_seed"`
+
+    Server     ServerConfig     `yaml:"server"`
+    Log        LoggerConfig     `yaml:"log"`
+    Middleware MiddlewareConfig `yaml:"middleware"`
+    DB         DBConfig         `yaml:"db"`
+    Tracing    TracingConfig    `yaml:"tracing"`
+    Client     ClientConfig     `yaml:"client"`
+}
+
+// NewAppConfig constructs the default AppConfig.
+func NewAppConfig() AppConfig {
+    return AppConfig{
+        Greeting:     DefaultGreeting,
+        StartTimeout: DefaultStartTimeout,
+        StopTimeout:  DefaultStopTimeout,
+        Workers:      DefaultWorkers,
+        JobOverrun:   JobOverrunSkip,
+        Server:       NewServerConfig(),
+        Log:          NewLoggerConfig(),
+        Middleware:   NewMiddlewareConfig(),
+        Client:       NewClientConfig(),
+    }
+}
+
+// NewConfig loads the AppConfig from the YAML file named by the CONFIG_PATH
+// environment variable (config.yaml by default). Settings missing from the
+// file keep their defaults, and a missing file means all defaults. A file
+// that exists but can't be read or parsed is an error, so Fx aborts startup
+// rather than running with a configuration nobody intended.
+//
+// Environment variables then override individual settings (see applyEnv), so
+// the precedence is environment, then file, then defaults.
+/*
+    NewConfig 从CONFIG_PATH环境变量指定的YAML文件（默认为config.yaml）加载AppConfig。
+    文件中缺失的设置保留默认值，文件不存在则全部使用默认值。文件存在但无法读取或解析
+    时返回错误，这样Fx会中止启动，而不是以一个非预期的配置运行。
+
+    随后环境变量会覆盖单个设置（参见applyEnv），因此优先级为：环境变量 > 文件 > 默认值。
+*/
+func NewConfig() (AppConfig, error) {
+    cfg := NewAppConfig()
+    path := os.Getenv("CONFIG_PATH")
+    if path == "" {
+        path = DefaultConfigPath
+    }
+    data, err := os.ReadFile(path)
+    switch {
+    case errors.Is(err, fs.ErrNotExist):
+        // No file: keep the defaults.
+    case err != nil:
+        return AppConfig{}, fmt.Errorf("reading config file %s: %w", path, err)
+    default:
+        if err := yaml.Unmarshal(data, &cfg); err != nil {
+            return AppConfig{}, fmt.Errorf("parsing config file %s: %w", path, err)
+        }
+    }
+    if err := applyEnv(&cfg); err != nil {
+        return AppConfig{}, err
+    }
+    return cfg, nil
+}
+
+// applyEnv overrides cfg with whichever of these environment variables are
+// set: SERVER_ADDR, LOG_LEVEL, LOG_FORMAT and GREETING. A LOG_LEVEL that
+// isn't a level is an error, leaving cfg's level as it was.
+func applyEnv(cfg *AppConfig) error {
+    if v, ok := os.LookupEnv("SERVER_ADDR"); ok {
+        cfg.Server.Addr = v
+    }
+    if v, ok := os.LookupEnv("LOG_LEVEL"); ok {
+        level, err := parseLevel(v)
+        if err != nil {
+            return fmt.Errorf("LOG_LEVEL: %w", err)
+        }
+        cfg.Log.Level = level
+    }
+    if v, ok := os.LookupEnv("LOG_FORMAT"); ok {
+        cfg.Log.Format = v
+    }
+    if v, ok := os.LookupEnv("GREETING"); ok {
+        cfg.Greeting = v
+    }
+    return nil
+}
+
+// ComponentConfigs splits an AppConfig into the per-component configs the
+// rest of the graph depends on.
+/*
+    ComponentConfigs 将AppConfig拆分为依赖图其余部分所依赖的各组件配置。
+*/
+type ComponentConfigs struct {
+    fx.Out
+
+    Server     ServerConfig
+    Log        LoggerConfig
+    Middleware MiddlewareConfig
+    DB         DBConfig
+    Tracing    TracingConfig
+    Client     ClientConfig
+}
+
+// NewComponentConfigs provides each component's config from the AppConfig.
+func NewComponentConfigs(c AppConfig) ComponentConfigs {
+    return ComponentConfigs{
+        Server:     c.Server,
+        Log:        c.Log,
+        Middleware: c.Middleware,
+        DB:         c.DB,
+        Tracing:    c.Tracing,
+        Client:     c.Client,
+    }
+}
+
+func (c AppConfig) greeting() string {
+    if c.Greeting == "" {
+        return DefaultGreeting
+    }
+    return c.Greeting
+}
+
+// Validate checks the configuration's invariants - a usable listen address,
+// positive start and stop timeouts, no negative durations or limits, known
+// log levels, formats and modes - and reports every problem it finds in one
+// error, so a bad config file can be fixed in one pass.
+/*
+    Validate 检查配置的不变量：可用的监听地址、正数的启动和停止超时、没有负的时长或
+    限制、已知的日志级别、格式和模式，并在一个错误中报告发现的所有问题，这样错误的配置
+    文件可以一次性修正。
+*/
+func (c AppConfig) Validate() error {
+    var problems []string
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            problems = append(problems, fmt.Sprintf(format, args...))
+        }
+    }
+    nonNegative := func(name string, d time.Duration) {
+        check(d >= 0, "%s must not be negative, got %s", name, d)
+    }
+
+    check(c.StartTimeout > 0, "start_timeout must be positive, got %s", c.StartTimeout)
+    check(c.StopTimeout > 0, "stop_timeout must be positive, got %s", c.StopTimeout)
+    check(c.Workers >= 0, "workers must not be negative, got %d", c.Workers)
+    check(c.JobOverrun == "" || c.JobOverrun == JobOverrunSkip || c.JobOverrun == JobOverrunWarn,
+        "job_overrun must be %q or %q, got %q", JobOverrunSkip, JobOverrunWarn, c.JobOverrun)
+
+    switch network := c.Server.network(); network {
+    case NetworkUnix:
+        check(c.Server.Addr != "", "server.addr must be a socket path when server.network is %q", NetworkUnix)
+    case NetworkTCP, NetworkTCP4, NetworkTCP6:
+        host, _, err := net.SplitHostPort(c.Server.addr())
+        check(err == nil, "server.addr %q is not a host:port address: %v", c.Server.Addr, err)
+        if ip := net.ParseIP(host); ip != nil {
+            check(network != NetworkTCP4 || ip.To4() != nil,
+                "server address %s is not IPv4, but server.network is %q", host, NetworkTCP4)
+            check(network != NetworkTCP6 || ip.To4() == nil,
+                "server address %s is not IPv6, but server.network is %q", host, NetworkTCP6)
+        }
+    default:
+        check(false, "server.network must be %q, %q, %q or %q, got %q",
+            NetworkTCP, NetworkTCP4, NetworkTCP6, NetworkUnix, network)
+    }
+    nonNegative("server.shutdown_timeout", c.Server.ShutdownTimeout)
+    nonNegative("server.read_timeout", c.Server.ReadTimeout)
+    nonNegative("server.write_timeout", c.Server.WriteTimeout)
+    nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+
+    check(c.Log.Level >= LevelDebug && c.Log.Level <= LevelError, "log.level %s is not a valid level", c.Log.Level)
+    check(c.Log.Format == "" || c.Log.Format == LogFormatText || c.Log.Format == LogFormatJSON,
+        "log.format must be %q or %q, got %q", LogFormatText, LogFormatJSON, c.Log.Format)
+    check(c.Log.Backend == "" || c.Log.Backend == LogBackendLog || c.Log.Backend == LogBackendSlog,
+        "log.backend must be %q or %q, got %q", LogBackendLog, LogBackendSlog, c.Log.Backend)
+    check(c.Log.MaxSizeMB >= 0, "log.max_size_mb must not be negative, got %d", c.Log.MaxSizeMB)
+    check(c.Log.MaxBackups >= 0, "log.max_backups must not be negative, got %d", c.Log.MaxBackups)
+    check(c.Log.MaxAgeDays >= 0, "log.max_age_days must not be negative, got %d", c.Log.MaxAgeDays)
+
+    m := c.Middleware
+    switch m.AccessLog {
+    case "", AccessLogCommon, AccessLogCombined, AccessLogOff:
+    default:
+        check(false, "middleware.access_log must be %q, %q or %q, got %q",
+            AccessLogCommon, AccessLogCombined, AccessLogOff, m.AccessLog)
+    }
+    switch m.TrailingSlash {
+    case "", TrailingSlashOff, TrailingSlashStrip, TrailingSlashAppend:
+    default:
+        check(false, "middleware.trailing_slash must be %q, %q or %q, got %q",
+            TrailingSlashOff, TrailingSlashStrip, TrailingSlashAppend, m.TrailingSlash)
+    }
+    switch m.DuplicateRoutes {
+    case "", DuplicateRoutesError, DuplicateRoutesWarn:
+    default:
+        check(false, "middleware.duplicate_routes must be %q or %q, got %q",
+            DuplicateRoutesError, DuplicateRoutesWarn, m.DuplicateRoutes)
+    }
+    if m.PathPrefix != "" {
+        check(strings.HasPrefix(m.PathPrefix, "/") && !strings.HasSuffix(m.PathPrefix, "/"),
+            "middleware.path_prefix must start with \"/\" and not end with one, got %q", m.PathPrefix)
+    }
+    nonNegative("middleware.request_timeout", m.RequestTimeout)
+    if m.RequestTimeout > 0 && c.Server.WriteTimeout > 0 {
+        check(m.RequestTimeout < c.Server.WriteTimeout,
+            "middleware.request_timeout (%s) must be shorter than server.write_timeout (%s), or requests are cut off before their 503",
+            m.RequestTimeout, c.Server.WriteTimeout)
+    }
+    nonNegative("middleware.cache_ttl", m.CacheTTL)
+    nonNegative("middleware.slow_request_threshold", m.SlowRequestThreshold)
+    check(m.RateLimit.Rate >= 0, "middleware.rate_limit.rate must not be negative, got %g", m.RateLimit.Rate)
+    check(m.RateLimit.Burst >= 0, "middleware.rate_limit.burst must not be negative, got %d", m.RateLimit.Burst)
+    check(m.Concurrency.Max >= 0, "middleware.concurrency.max must not be negative, got %d", m.Concurrency.Max)
+    nonNegative("middleware.concurrency.wait", m.Concurrency.Wait)
+    nonNegative("middleware.security_headers.hsts_max_age", m.SecurityHeaders.HSTSMaxAge)
+    check(m.Audit.MaxBodyBytes >= 0, "middleware.audit.max_body_bytes must not be negative, got %d", m.Audit.MaxBodyBytes)
+    for _, pattern := range m.Audit.Redact {
+        _, err := regexp.Compile(pattern)
+        check(err == nil, "middleware.audit.redact pattern %q: %v", pattern, err)
+    }
+    check(m.BasicAuth.Username == "" || m.BasicAuth.Password != "",
+        "middleware.basic_auth.password must be set when a username is")
+
+    if c.DB.Driver != "" {
+        check(c.DB.DSN != "", "db.dsn must be set when db.driver is")
+    }
+    nonNegative("client.timeout", c.Client.Timeout)
+    nonNegative("client.dial_timeout", c.Client.DialTimeout)
+    nonNegative("client.idle_conn_timeout", c.Client.IdleConnTimeout)
+    check(c.Client.Breaker.FailureThreshold >= 0,
+        "client.breaker.failure_threshold must not be negative, got %d", c.Client.Breaker.FailureThreshold)
+    nonNegative("client.breaker.reset_timeout", c.Client.Breaker.ResetTimeout)
+    nonNegative("db.ping_timeout", c.DB.PingTimeout)
+    nonNegative("db.ping_backoff", c.DB.PingBackoff)
+
+    if len(problems) == 0 {
+        return nil
+    }
+    return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+}
+
+// ValidateConfig is an invocation that fails startup with AppConfig.Validate's
+// error, before any server is built.
+func ValidateConfig(cfg AppConfig) error {
+    return cfg.Validate()
+}
+
+// DefaultAddr is the address NewMux listens on when no ServerConfig is
+// provided or its Addr is empty.
+const DefaultAddr = ":8080"
+
+// Default timeouts applied by NewServerConfig.
+const (
+    DefaultReadTimeout  = 15 * time.Second
+    DefaultWriteTimeout = 15 * time.Second
+    DefaultIdleTimeout  = 60 * time.Second
+)
+
+// ServerConfig holds the settings NewMux uses to build its http.Server.
+//
+// It's an ordinary struct: Fx doesn't care where it comes from, so tests and
+// production can each provide their own without touching NewMux.
+/*
+    ServerConfig 保存NewMux构建http.Server时使用的设置。
+
+    它只是一个普通的结构体：Fx并不关心它从哪里来，因此测试和生产环境可以各自提供自己
+    的配置，而无需修改NewMux。
+*/
+type ServerConfig struct {
+    // Addr is the TCP address to listen on, e.g. ":8080", "127.0.0.1:9090"
+    // or "[::1]:8080", or the socket path when Network is NetworkUnix.
+    Addr string `yaml:"addr"`
+
+    // Host, if set, replaces the host part of Addr, keeping its port. It's
+    // written without brackets even for IPv6 ("::" or "::1"), which saves
+    // quoting them in YAML.
+    Host string `yaml:"host"`
+
+    // Network is NetworkTCP (the default), NetworkTCP4, NetworkTCP6 or
+    // NetworkUnix. With NetworkTCP, an empty or wildcard host (":8080",
+    // "[::]:8080") binds dual-stack where the OS allows it, accepting both
+    // IPv4 and IPv6; NetworkTCP4 and NetworkTCP6 restrict the server to one
+    // family. A Unix socket is created with mode 0660, replacing any stale
+    // socket at the same path, and removed again on shutdown.
+    Network string `yaml:"network"`
+
+    // ShutdownTimeout bounds how long OnStop waits for in-flight requests to
+    // finish, independent of the stop context's own deadline. Zero means the
+    // stop context is used unchanged. Request contexts are cancelled when
+    // OnStop begins, so handlers that honor them finish well within it.
+    ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+    // ReadTimeout, WriteTimeout and IdleTimeout are copied onto the
+    // http.Server to keep slow or idle clients from holding connections open
+    // forever. As in net/http, zero disables the corresponding timeout.
+    ReadTimeout  time.Duration `yaml:"read_timeout"`
+    WriteTimeout time.Duration `yaml:"write_timeout"`
+    IdleTimeout  time.Duration `yaml:"idle_timeout"`
+
+    // EnableH2C serves HTTP/2 over cleartext alongside HTTP/1.1, for setups
+    // behind a proxy that terminates TLS (or doesn't use it at all). The
+    // default is HTTP/1.1 only.
+    EnableH2C bool `yaml:"enable_h2c"`
+
+    // LogConnState logs every connection state transition (new, active,
+    // idle, closed) at DEBUG and counts them for /debug/conns. It's verbose,
+    // so it's off by default.
+    LogConnState bool `yaml:"log_conn_state"`
+
+    // ReusePort binds the TCP listener with SO_REUSEPORT, so that during a
+    // blue-green or rolling restart on one host the new process can bind
+    // the port while the old one still holds it. The kernel spreads new
+    // connections across both until the old process's OnStop hook calls
+    // Shutdown, which closes its listener at once; from then on only the new
+    // process accepts, while the old one drains the requests it already has.
+    // (Connections still queued on the old listener when it closes are
+    // reset, so keep the overlap short under heavy load.) SO_REUSEPORT is
+    // only used on Linux; elsewhere the server logs a warning and listens
+    // normally. A provided ListenFunc takes precedence.
+    ReusePort bool `yaml:"reuse_port"`
+
+    // DisableKeepAlives closes each connection after one request, for load
+    // balancers that would rather spread short-lived connections than have
+    // clients hold on to one server. Keep-alives are on by default.
+    DisableKeepAlives bool `yaml:"disable_keep_alives"`
+}
+
+// NewServerConfig constructs the default ServerConfig: DefaultAddr, with 15s
+// read and write timeouts and a 60s idle timeout.
+func NewServerConfig() ServerConfig {
+    return ServerConfig{
+        Addr:         DefaultAddr,
+        ReadTimeout:  DefaultReadTimeout,
+        WriteTimeout: DefaultWriteTimeout,
+        IdleTimeout:  DefaultIdleTimeout,
+    }
+}
+
+// addr returns the configured listen address, falling back to DefaultAddr
+// for TCP and applying Host. Unix sockets have no default path.
+func (c ServerConfig) addr() string {
+    if c.network() == NetworkUnix {
+        return c.Addr
+    }
+    addr := c.Addr
+    if addr == "" {
+        addr = DefaultAddr
+    }
+    if c.Host != "" {
+        if _, port, err := net.SplitHostPort(addr); err == nil {
+            addr = net.JoinHostPort(c.Host, port)
+        }
+    }
+    return addr
+}
+
+// network returns the configured network, falling back to NetworkTCP.
+func (c ServerConfig) network() string {
+    if c.Network == "" {
+        return NetworkTCP
+    }
+    return c.Network
+}
+
+// LoggerConfig holds the settings NewLogger uses to build the LeveledLogger.
+/*
+    LoggerConfig 保存NewLogger构建LeveledLogger时使用的设置。
+*/
+type LoggerConfig struct {
+    // Level is the threshold below which log lines are dropped.
+    Level Level `yaml:"level"`
+    // Format is LogFormatText (the default) or LogFormatJSON.
+    Format string `yaml:"format"`
+    // Flags are the log.Logger flags for text output. JSON lines carry their
+    // own timestamp, so they ignore Flags.
+    Flags LogFlags `yaml:"flags"`
+    // Backend is LogBackendLog (the default), which writes through the
+    // standard library's log package, or LogBackendSlog, which writes through
+    // log/slog and lets middleware log structured attributes.
+    Backend string `yaml:"backend"`
+
+    // File, if set, is the file to log to instead of standard output. It's
+    // rotated once it grows past MaxSizeMB megabytes (lumberjack's default,
+    // 100, if zero); MaxBackups old files are kept, for at most MaxAgeDays
+    // days. Zero keeps them all, however old.
+    File       string `yaml:"file"`
+    MaxSizeMB  int    `yaml:"max_size_mb"`
+    MaxBackups int    `yaml:"max_backups"`
+    MaxAgeDays int    `yaml:"max_age_days"`
+}
+
+// NewLoggerConfig constructs the default LoggerConfig: INFO, as text, with
+// DefaultLogFlags, through the standard library's log package.
+func NewLoggerConfig() LoggerConfig {
+    return LoggerConfig{Level: LevelInfo, Format: LogFormatText, Flags: DefaultLogFlags, Backend: LogBackendLog}
+}
+
+// TLSConfig switches NewMux to HTTPS. Provide either a certificate and key
+// file pair or a ready-made *tls.Config (or both: the files are loaded into a
+// clone of Config). When nobody provides one, NewMux serves plaintext HTTP.
+/*
+    TLSConfig 将NewMux切换为HTTPS。提供证书和密钥文件对，或者现成的*tls.Config
+    （或两者兼有：文件会被加载到Config的副本中）。当没有提供时，NewMux提供明文HTTP服务。
+*/
+type TLSConfig struct {
+    CertFile string
+    KeyFile  string
+    Config   *tls.Config
+}
+
+func (c TLSConfig) enabled() bool {
+    return c.CertFile != "" || c.KeyFile != "" || c.Config != nil
+}
+
+// load builds the *tls.Config the server should use. If certificate files are
+// configured, it also returns the certReloader serving them, which can pick up
+// a rotated certificate later.
+func (c TLSConfig) load() (*tls.Config, *certReloader, error) {
+    cfg := &tls.Config{}
+    if c.Config != nil {
+        cfg = c.Config.Clone()
+    }
+    if c.CertFile == "" && c.KeyFile == "" {
+        return cfg, nil, nil
+    }
+    certs, err := newCertReloader(c.CertFile, c.KeyFile)
+    if err != nil {
+        return nil, nil, err
+    }
+    cfg.GetCertificate = certs.GetCertificate
+    return cfg, certs, nil
+}
+
+// MiddlewareConfig holds the settings for Register and the middleware it wraps
+// every route with.
+/*
+    MiddlewareConfig 保存Register及其用来包装每个路由的中间件的设置。
+*/
+type MiddlewareConfig struct {
+    // NoDefaultRoute stops Register from mounting a placeholder handler on
+    // "/" when no routes were provided at all.
+    NoDefaultRoute bool `yaml:"no_default_route"`
+
+    // DisableRecovery lets panics propagate to net/http instead of being
+    // turned into 500 responses, which can be handy when debugging.
+    DisableRecovery bool `yaml:"disable_recovery"`
+
+    // AccessLog is the access log format: AccessLogCommon (the default),
+    // AccessLogCombined, or AccessLogOff.
+    AccessLog string `yaml:"access_log"`
+
+    // RequestTimeout is the per-request deadline applied to every route that
+    // doesn't set Route.NoTimeout; requests that exceed it get a 503. Zero
+    // disables it. It must be shorter than the server's WriteTimeout, which
+    // would otherwise close the connection before the 503 could be written.
+    RequestTimeout time.Duration `yaml:"request_timeout"`
+
+    // SlowRequestThreshold is the duration past which a request is logged as
+    // slow, at WARN. Zero turns the slow request log off.
+    SlowRequestThreshold time.Duration `yaml:"slow_request_threshold"`
+
+    CORS CORSConfig `yaml:"cors"`
+
+    // Metadata is a set of key/value pairs describing the deployment - its
+    // environment, region and so on - that every request's context carries
+    // (see MetadataFrom). MetadataEnvironment and MetadataRegion have typed
+    // helpers of their own.
+    Metadata map[string]string `yaml:"metadata"`
+
+    // SecurityHeaders are set on every response, with secure defaults (see
+    // NewSecurityHeadersConfig).
+    SecurityHeaders SecurityHeadersConfig `yaml:"security_headers"`
+
+    // RateLimit limits how fast each client can make requests. Rate limiting
+    // runs inside CORS, so 429s still carry CORS headers and preflights don't
+    // count against the limit.
+    RateLimit RateLimitConfig `yaml:"rate_limit"`
+
+    // Concurrency caps the requests handled at once across all routes;
+    // requests over the cap get a 503. Individual routes can set a tighter
+    // cap of their own with Route.MaxConcurrent. Long-lived requests, such as
+    // /stream's, hold a slot for as long as they last.
+    Concurrency ConcurrencyConfig `yaml:"concurrency"`
+
+    // BasicAuth holds the credentials for routes flagged Route.Protected.
+    BasicAuth BasicAuthConfig `yaml:"basic_auth"`
+
+    // MaxBodyBytes caps request bodies; larger ones get a 413. Routes can
+    // override it with Route.MaxBodyBytes. Zero or negative disables the cap.
+    MaxBodyBytes int64 `yaml:"max_body_bytes"`
+
+    // CacheTTL is how long responses from routes flagged Route.Cacheable are
+    // served from the cache, unless the route sets its own Route.CacheTTL.
+    CacheTTL time.Duration `yaml:"cache_ttl"`
+
+    // Audit configures the audit log kept for routes flagged Route.Audit.
+    Audit AuditConfig `yaml:"audit"`
+
+    // TrailingSlash normalizes URLs by redirecting "/foo/" to "/foo"
+    // (TrailingSlashStrip) or "/foo" to "/foo/" (TrailingSlashAppend), ahead
+    // of every other middleware. The default, TrailingSlashOff, leaves paths
+    // alone.
+    TrailingSlash string `yaml:"trailing_slash"`
+
+    // PathPrefix mounts the routes on the default server under a prefix such
+    // as "/api", for running behind a reverse proxy at a subpath. It must
+    // start with "/" and not end with one. Paths listed in UnprefixedPaths -
+    // by default the health checks and /metrics, which the proxy's load
+    // balancer and Prometheus usually reach directly - stay where they are,
+    // and so do routes on named servers. With StripPrefix, handlers see
+    // request paths without the prefix, as if it weren't there; middleware
+    // and the access log still see the full path.
+    PathPrefix      string   `yaml:"path_prefix"`
+    StripPrefix     bool     `yaml:"strip_prefix"`
+    UnprefixedPaths []string `yaml:"unprefixed_paths"`
+
+    // RequiredRoutes names the optional routes (see OptionalRoute) that must
+    // build: if one of them fails, so does startup. Any other optional route
+    // that fails is logged and left out.
+    RequiredRoutes []string `yaml:"required_routes"`
+
+    // DuplicateRoutes decides what happens when two routes claim the same
+    // method and path: DuplicateRoutesError (the default) fails startup,
+    // DuplicateRoutesWarn logs a warning and keeps the first.
+    DuplicateRoutes string `yaml:"duplicate_routes"`
+}
+
+// DefaultMaxBodyBytes is the MaxBodyBytes NewMiddlewareConfig applies: 1MB.
+const DefaultMaxBodyBytes = 1 << 20
+
+// DefaultRequestTimeout is the RequestTimeout NewMiddlewareConfig applies,
+// comfortably inside DefaultWriteTimeout.
+const DefaultRequestTimeout = 10 * time.Second
+
+// DefaultSlowRequestThreshold is the SlowRequestThreshold NewMiddlewareConfig
+// applies.
+const DefaultSlowRequestThreshold = time.Second
+
+// Access log formats understood by MiddlewareConfig.AccessLog.
+const (
+    AccessLogCommon   = "common"
+    AccessLogCombined = "combined"
+    AccessLogOff      = "off"
+)
+
+// Duplicate route policies understood by MiddlewareConfig.DuplicateRoutes.
+const (
+    DuplicateRoutesError = "error"
+    DuplicateRoutesWarn  = "warn"
+)
+
+// NewMiddlewareConfig constructs the default MiddlewareConfig.
+func NewMiddlewareConfig() MiddlewareConfig {
+    return MiddlewareConfig{
+        AccessLog:            AccessLogCommon,
+        RequestTimeout:       DefaultRequestTimeout,
+        MaxBodyBytes:         DefaultMaxBodyBytes,
+        CacheTTL:             DefaultCacheTTL,
+        SlowRequestThreshold: DefaultSlowRequestThreshold,
+        DuplicateRoutes:      DuplicateRoutesError,
+        SecurityHeaders:      NewSecurityHeadersConfig(),
+        UnprefixedPaths:      []string{"/healthz", "/readyz", "/metrics"},
+    }
+}
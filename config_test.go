@@ -0,0 +1,142 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// withEnv sets the variables in env for the rest of the test, and unsets the
+// ones NewConfig reads that env leaves out, so the environment the tests run
+// in can't leak into them.
+func withEnv(t *testing.T, env map[string]string) {
+    t.Helper()
+    for _, name := range []string{"CONFIG_PATH", "SERVER_ADDR", "LOG_LEVEL", "LOG_FORMAT", "GREETING"} {
+        // t.Setenv restores the original value when the test ends, even
+        // after the Unsetenv.
+        t.Setenv(name, "")
+        os.Unsetenv(name)
+    }
+    for name, value := range env {
+        t.Setenv(name, value)
+    }
+}
+
+// writeConfig writes a config file to a temporary directory, returning its
+// path.
+func writeConfig(t *testing.T, yaml string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "config.yaml")
+    if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestConfigDefaults(t *testing.T) {
+    withEnv(t, map[string]string{"CONFIG_PATH": filepath.Join(t.TempDir(), "missing.yaml")})
+
+    cfg, err := NewConfig()
+    if err != nil {
+        t.Fatalf("NewConfig: %v", err)
+    }
+    if cfg.Server.Addr != DefaultAddr || cfg.Log.Level != LevelInfo || cfg.Greeting != DefaultGreeting {
+        t.Errorf("NewConfig without a file = addr %q, level %s, greeting %q; want the defaults %q, %s, %q",
+            cfg.Server.Addr, cfg.Log.Level, cfg.Greeting, DefaultAddr, LevelInfo, DefaultGreeting)
+    }
+}
+
+func TestConfigFileOverridesDefaults(t *testing.T) {
+    withEnv(t, map[string]string{"CONFIG_PATH": writeConfig(t, `
+server:
+  addr: ":9090"
+log:
+  level: WARN
+`)})
+
+    cfg, err := NewConfig()
+    if err != nil {
+        t.Fatalf("NewConfig: %v", err)
+    }
+    if cfg.Server.Addr != ":9090" || cfg.Log.Level != LevelWarn {
+        t.Errorf("NewConfig = addr %q, level %s; want the file's \":9090\", WARN", cfg.Server.Addr, cfg.Log.Level)
+    }
+    // Settings the file leaves out keep their defaults.
+    if cfg.Greeting != DefaultGreeting || cfg.Server.WriteTimeout != DefaultWriteTimeout {
+        t.Errorf("NewConfig = greeting %q, write timeout %s; want the defaults %q, %s",
+            cfg.Greeting, cfg.Server.WriteTimeout, DefaultGreeting, DefaultWriteTimeout)
+    }
+}
+
+func TestConfigEnvOverridesFile(t *testing.T) {
+    withEnv(t, map[string]string{
+        "CONFIG_PATH": writeConfig(t, `
+server:
+  addr: ":9090"
+log:
+  level: WARN
+greeting: from the file
+`),
+        "SERVER_ADDR": ":7070",
+        "LOG_LEVEL":   "debug",
+    })
+
+    cfg, err := NewConfig()
+    if err != nil {
+        t.Fatalf("NewConfig: %v", err)
+    }
+    if cfg.Server.Addr != ":7070" || cfg.Log.Level != LevelDebug {
+        t.Errorf("NewConfig = addr %q, level %s; want the environment's \":7070\", DEBUG", cfg.Server.Addr, cfg.Log.Level)
+    }
+    // Settings the environment leaves out keep the file's values.
+    if cfg.Greeting != "from the file" {
+        t.Errorf("NewConfig = greeting %q, want the file's", cfg.Greeting)
+    }
+}
+
+func TestConfigEnvRejectsUnknownLevel(t *testing.T) {
+    withEnv(t, map[string]string{
+        "CONFIG_PATH": filepath.Join(t.TempDir(), "missing.yaml"),
+        "LOG_LEVEL":   "verbose",
+    })
+
+    if _, err := NewConfig(); err == nil {
+        t.Error("NewConfig accepted LOG_LEVEL=verbose")
+    }
+}
+
+func TestConfigValidateDefaults(t *testing.T) {
+    if err := NewAppConfig().Validate(); err != nil {
+        t.Errorf("default configuration is invalid: %v", err)
+    }
+}
+
+func TestConfigValidateListsEveryProblem(t *testing.T) {
+    cfg := NewAppConfig()
+    cfg.StopTimeout = 0
+    cfg.Log.Format = "xml"
+    cfg.Middleware.PathPrefix = "api/"
+    cfg.Middleware.Audit.Redact = []string{"("}
+    cfg.DB = DBConfig{Driver: testDriverName}
+
+    err := cfg.Validate()
+    if err == nil {
+        t.Fatal("Validate accepted an invalid configuration")
+    }
+    msg := err.Error()
+    if !strings.HasPrefix(msg, "invalid configuration:\n") {
+        t.Errorf("error = %q, want it to start with \"invalid configuration:\"", msg)
+    }
+    for _, want := range []string{
+        "stop_timeout must be positive",
+        "log.format must be",
+        "middleware.path_prefix must start with",
+        "middleware.audit.redact pattern",
+        "db.dsn must be set",
+    } {
+        if !strings.Contains(msg, "\n  - "+want) {
+            t.Errorf("error doesn't list %q:\n%s", want, msg)
+        }
+    }
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+    "encoding/json"
+    "net"
+    "net/http"
+    "sync"
+    "sync/atomic"
+)
+
+// ConnStats counts connection state transitions for each server that has
+// ServerConfig.LogConnState set. Watching the counts under load shows whether
+// keep-alive connections are being reused, and whether connections are
+// leaking (open climbing while closed stays flat).
+/*
+    ConnStats 为每个设置了ServerConfig.LogConnState的服务器统计连接状态的转换。在负载
+    下观察这些计数可以看出keep-alive连接是否被复用，以及连接是否泄漏（open持续上升而
+    closed保持不变）。
+*/
+type ConnStats struct {
+    mu      sync.Mutex
+    servers map[string]*connCounters
+}
+
+// NewConnStats constructs an empty ConnStats.
+func NewConnStats() *ConnStats {
+    return &ConnStats{servers: make(map[string]*connCounters)}
+}
+
+// connCounters are one server's counts. Each state counts transitions into
+// it; Open is the number of connections not yet closed or hijacked.
+type connCounters struct {
+    New      atomic.Int64
+    Active   atomic.Int64
+    Idle     atomic.Int64
+    Hijacked atomic.Int64
+    Closed   atomic.Int64
+    Open     atomic.Int64
+}
+
+// server returns the counters for the server labelled label, creating them if
+// needed.
+func (s *ConnStats) server(label string) *connCounters {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    c, ok := s.servers[label]
+    if !ok {
+        c = &connCounters{}
+        s.servers[label] = c
+    }
+    return c
+}
+
+func (c *connCounters) record(state http.ConnState) {
+    switch state {
+    case http.StateNew:
+        c.New.Add(1)
+        c.Open.Add(1)
+    case http.StateActive:
+        c.Active.Add(1)
+    case http.StateIdle:
+        c.Idle.Add(1)
+    case http.StateHijacked:
+        c.Hijacked.Add(1)
+        c.Open.Add(-1)
+    case http.StateClosed:
+        c.Closed.Add(1)
+        c.Open.Add(-1)
+    }
+}
+
+// snapshot returns the counts as plain numbers, keyed by state.
+func (c *connCounters) snapshot() map[string]int64 {
+    return map[string]int64{
+        "new":      c.New.Load(),
+        "active":   c.Active.Load(),
+        "idle":     c.Idle.Load(),
+        "hijacked": c.Hijacked.Load(),
+        "closed":   c.Closed.Load(),
+        "open":     c.Open.Load(),
+    }
+}
+
+// connStateHook returns an http.Server.ConnState callback that records each
+// transition in counters and logs it at DEBUG.
+func connStateHook(counters *connCounters, logger *LeveledLogger, label string) func(net.Conn, http.ConnState) {
+    return func(c net.Conn, state http.ConnState) {
+        counters.record(state)
+        logger.Debugf("Connection from %s to %s: %s.", c.RemoteAddr(), label, state)
+    }
+}
+
+// NewConnStatsHandler constructs the /debug/conns route, reporting each
+// server's connection counts as JSON. Like the other debug routes, it's only
+// registered when AppConfig.EnablePprof is set, and it's provided through
+// OptionalRoute, as "conns".
+/*
+    NewConnStatsHandler 构造/debug/conns路由，以JSON报告每个服务器的连接计数。与其他
+    调试路由一样，只有在设置了AppConfig.EnablePprof时才会注册，并通过OptionalRoute以
+    "conns"之名提供。
+*/
+func NewConnStatsHandler(p DebugParams, stats *ConnStats) ([]Route, error) {
+    if !p.Config.EnablePprof {
+        return nil, nil
+    }
+    h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        stats.mu.Lock()
+        out := make(map[string]map[string]int64, len(stats.servers))
+        for label, c := range stats.servers {
+            out[label] = c.snapshot()
+        }
+        stats.mu.Unlock()
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(out)
+    })
+    return p.mount(Route{Path: "/debug/conns", Handler: h})
+}
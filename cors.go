@@ -0,0 +1,79 @@
+package main
+
+import (
+    "net/http"
+    "strings"
+)
+
+// CORSConfig holds the Cross-Origin Resource Sharing settings. An empty
+// AllowedOrigins list disables CORS handling entirely.
+/*
+    CORSConfig 保存跨域资源共享（CORS）的设置。AllowedOrigins为空时完全禁用CORS处理。
+*/
+type CORSConfig struct {
+    // AllowedOrigins lists the origins allowed to make cross-origin requests,
+    // matched exactly; "*" allows any origin.
+    AllowedOrigins []string `yaml:"allowed_origins"`
+    // AllowedMethods and AllowedHeaders are advertised in preflight
+    // responses. AllowedMethods defaults to GET, HEAD and POST.
+    AllowedMethods []string `yaml:"allowed_methods"`
+    AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+func (c CORSConfig) enabled() bool {
+    return len(c.AllowedOrigins) > 0
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or ""
+// if it isn't allowed.
+func (c CORSConfig) allowOrigin(origin string) string {
+    for _, o := range c.AllowedOrigins {
+        if o == "*" {
+            return "*"
+        }
+        if o == origin {
+            return origin
+        }
+    }
+    return ""
+}
+
+// cors sets the Access-Control-* headers for allowed origins and answers
+// preflight requests with 204 without calling next.
+func cors(next http.Handler, cfg CORSConfig) http.Handler {
+    methods := cfg.AllowedMethods
+    if len(methods) == 0 {
+        methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+    }
+    allowMethods := strings.Join(methods, ", ")
+    allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        origin := r.Header.Get("Origin")
+        if origin == "" {
+            next.ServeHTTP(w, r)
+            return
+        }
+        h := w.Header()
+        h.Add("Vary", "Origin")
+        allowed := cfg.allowOrigin(origin)
+        if allowed != "" {
+            h.Set("Access-Control-Allow-Origin", allowed)
+        }
+
+        preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+        if !preflight {
+            next.ServeHTTP(w, r)
+            return
+        }
+        h.Add("Vary", "Access-Control-Request-Method")
+        h.Add("Vary", "Access-Control-Request-Headers")
+        if allowed != "" {
+            h.Set("Access-Control-Allow-Methods", allowMethods)
+            if allowHeaders != "" {
+                h.Set("Access-Control-Allow-Headers", allowHeaders)
+            }
+        }
+        w.WriteHeader(http.StatusNoContent)
+    })
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// corsHandler is cors around a handler that answers 200, recording whether
+// it was called.
+func corsHandler(cfg CORSConfig, called *bool) http.Handler {
+    return cors(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        *called = true
+        w.WriteHeader(http.StatusOK)
+    }), cfg)
+}
+
+func TestCORSPreflight(t *testing.T) {
+    cfg := CORSConfig{
+        AllowedOrigins: []string{"https://app.example.com"},
+        AllowedMethods: []string{http.MethodGet, http.MethodPut},
+        AllowedHeaders: []string{"Authorization"},
+    }
+    var called bool
+    req := httptest.NewRequest(http.MethodOptions, "/", nil)
+    req.Header.Set("Origin", "https://app.example.com")
+    req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+    rec := httptest.NewRecorder()
+    corsHandler(cfg, &called).ServeHTTP(rec, req)
+
+    if rec.Code != http.StatusNoContent {
+        t.Errorf("preflight = %d, want 204", rec.Code)
+    }
+    if called {
+        t.Error("preflight reached the handler")
+    }
+    for name, want := range map[string]string{
+        "Access-Control-Allow-Origin":  "https://app.example.com",
+        "Access-Control-Allow-Methods": "GET, PUT",
+        "Access-Control-Allow-Headers": "Authorization",
+    } {
+        if got := rec.Header().Get(name); got != want {
+            t.Errorf("preflight %s = %q, want %q", name, got, want)
+        }
+    }
+}
+
+func TestCORSPreflightFromDisallowedOrigin(t *testing.T) {
+    cfg := CORSConfig{AllowedOrigins: []string{"https://app.example.com"}}
+    var called bool
+    req := httptest.NewRequest(http.MethodOptions, "/", nil)
+    req.Header.Set("Origin", "https://evil.example.com")
+    req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+    rec := httptest.NewRecorder()
+    corsHandler(cfg, &called).ServeHTTP(rec, req)
+
+    for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods"} {
+        if got := rec.Header().Get(name); got != "" {
+            t.Errorf("preflight from a disallowed origin set %s: %q", name, got)
+        }
+    }
+}
+
+func TestCORSActualRequest(t *testing.T) {
+    tests := []struct {
+        name    string
+        allowed []string
+        origin  string
+        want    string
+    }{
+        {"exact match", []string{"https://app.example.com"}, "https://app.example.com", "https://app.example.com"},
+        {"wildcard", []string{"*"}, "https://any.example.com", "*"},
+        {"disallowed", []string{"https://app.example.com"}, "https://evil.example.com", ""},
+    }
+    for _, tt := range tests {
+        var called bool
+        req := httptest.NewRequest(http.MethodGet, "/", nil)
+        req.Header.Set("Origin", tt.origin)
+        rec := httptest.NewRecorder()
+        corsHandler(CORSConfig{AllowedOrigins: tt.allowed}, &called).ServeHTTP(rec, req)
+
+        if !called || rec.Code != http.StatusOK {
+            t.Errorf("%s: handler called %t, status %d; want it called and 200", tt.name, called, rec.Code)
+        }
+        if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+            t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.name, got, tt.want)
+        }
+        if got := rec.Header().Get("Vary"); got != "Origin" {
+            t.Errorf("%s: Vary = %q, want \"Origin\"", tt.name, got)
+        }
+    }
+}
+
+func TestCORSDisabledWithoutOrigins(t *testing.T) {
+    if m := NewCORSMiddleware(NewMiddlewareConfig()).Middleware; m.Wrap != nil {
+        t.Error("NewCORSMiddleware contributed a middleware with no allowed origins")
+    }
+}
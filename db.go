@@ -0,0 +1,154 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "fmt"
+    "time"
+
+    "go.uber.org/fx"
+)
+
+// Defaults for the startup database ping when DBConfig doesn't set them.
+const (
+    DefaultPingTimeout  = 5 * time.Second
+    DefaultPingAttempts = 5
+    DefaultPingBackoff  = 250 * time.Millisecond
+    maxPingBackoff      = 5 * time.Second
+)
+
+// DBConfig holds the settings NewDB uses to open the connection pool.
+/*
+    DBConfig 保存NewDB打开连接池时使用的设置。
+*/
+type DBConfig struct {
+    // Driver is the database/sql driver name, e.g. "postgres" or "mysql". The
+    // driver itself must be linked in with a blank import.
+    Driver string `yaml:"driver"`
+    DSN    string `yaml:"dsn"`
+
+    // MaxOpenConns and MaxIdleConns size the pool; zero keeps the
+    // database/sql defaults.
+    MaxOpenConns int `yaml:"max_open_conns"`
+    MaxIdleConns int `yaml:"max_idle_conns"`
+
+    // PingTimeout bounds each ping NewDB's OnStart hook makes. Defaults to
+    // DefaultPingTimeout.
+    PingTimeout time.Duration `yaml:"ping_timeout"`
+    // PingAttempts is how many times to ping before giving up, and
+    // PingBackoff the wait before the first retry, doubling after each one.
+    // Defaults to DefaultPingAttempts and DefaultPingBackoff.
+    PingAttempts int           `yaml:"ping_attempts"`
+    PingBackoff  time.Duration `yaml:"ping_backoff"`
+}
+
+// NewDB constructs the database connection pool. It's a dependency like any
+// other: handlers that need the database take a *sql.DB, and NewDB is only
+// called if one does.
+//
+// sql.Open doesn't connect, so the OnStart hook pings the database and fails
+// startup if it's unreachable; the OnStop hook closes the pool. In container
+// environments the database is often still starting, so the ping is retried
+// with exponential backoff - but never beyond the OnStart hook's own deadline.
+/*
+    NewDB 构造数据库连接池。它和其他依赖项一样：需要数据库的handler接收*sql.DB，只有
+    在有handler需要时才会调用NewDB。
+
+    sql.Open不会建立连接，因此OnStart hook会ping数据库，如果无法访问则启动失败；OnStop
+    hook关闭连接池。在容器环境中数据库常常仍在启动，因此ping会以指数退避的方式重试，
+    但绝不会超过OnStart hook自身的截止时间。
+*/
+func NewDB(lc fx.Lifecycle, ctx context.Context, cfg DBConfig, logger *LeveledLogger, order *HookOrder) (*sql.DB, error) {
+    db, err := sql.Open(cfg.Driver, cfg.DSN)
+    if err != nil {
+        return nil, fmt.Errorf("opening %s database: %w", cfg.Driver, err)
+    }
+    db.SetMaxOpenConns(cfg.MaxOpenConns)
+    db.SetMaxIdleConns(cfg.MaxIdleConns)
+
+    lc.Append(fx.Hook{
+        OnStart: func(startCtx context.Context) error {
+            logger.Infof("Connecting to %s database.", cfg.Driver)
+            logger.Debugf("OnStart #%d: db.", order.Start("db"))
+            if err := pingWithRetry(startCtx, ctx, db, cfg, logger); err != nil {
+                return fmt.Errorf("connecting to %s database: %w", cfg.Driver, err)
+            }
+            return nil
+        },
+        OnStop: func(context.Context) error {
+            logger.Infof("Closing %s database.", cfg.Driver)
+            logger.Debugf("OnStop #%d: db.", order.Stop("db"))
+            return db.Close()
+        },
+    })
+    return db, nil
+}
+
+// DBReady marks that the database's OnStart ping has succeeded by the time
+// anything depending on it starts. It carries nothing: what matters is that
+// constructing it constructs NewDB, so NewDB's hooks are registered - and
+// run - ahead of the dependent's.
+//
+// NewMux takes an optional DBReady, so providing one holds the HTTP servers
+// back until the database answers. Without it, the server could start
+// first: NewMux is usually built before the handlers that take a *sql.DB.
+// Like NewDBHealthCheck, it isn't part of HTTPModule; applications with a
+// database provide it alongside:
+//
+//   fx.Provide(NewDBReady, NewDBHealthCheck),
+/*
+    DBReady 标记在依赖它的组件启动时，数据库的OnStart ping已经成功。它不携带任何内容：
+    关键在于构造它就会构造NewDB，因此NewDB的hooks会先于依赖方的hooks注册和运行。
+
+    NewMux接收一个可选的DBReady，因此提供它会让HTTP服务器等到数据库响应后再启动。没有
+    它时，服务器可能先启动：NewMux通常在接收*sql.DB的handlers之前构建。与
+    NewDBHealthCheck一样，它不属于HTTPModule；使用数据库的应用程序一并提供它（示例见上）。
+*/
+type DBReady struct{}
+
+// NewDBReady provides the DBReady marker for db.
+func NewDBReady(*sql.DB) DBReady {
+    return DBReady{}
+}
+
+// pingWithRetry pings db until it answers, cfg.PingAttempts run out, or
+// either context is done. Each attempt is bounded by cfg.PingTimeout.
+func pingWithRetry(startCtx, appCtx context.Context, db *sql.DB, cfg DBConfig, logger *LeveledLogger) error {
+    timeout := cfg.PingTimeout
+    if timeout <= 0 {
+        timeout = DefaultPingTimeout
+    }
+    attempts := cfg.PingAttempts
+    if attempts <= 0 {
+        attempts = DefaultPingAttempts
+    }
+    backoff := cfg.PingBackoff
+    if backoff <= 0 {
+        backoff = DefaultPingBackoff
+    }
+
+    var err error
+    for attempt := 1; ; attempt++ {
+        pingCtx, cancel := context.WithTimeout(startCtx, timeout)
+        err = db.PingContext(pingCtx)
+        cancel()
+        if err == nil || attempt == attempts {
+            return err
+        }
+        logger.Warnf("Database ping %d/%d failed, retrying in %s: %v", attempt, attempts, backoff, err)
+
+        timer := time.NewTimer(backoff)
+        select {
+        case <-timer.C:
+        case <-startCtx.Done():
+            timer.Stop()
+            return fmt.Errorf("%w (last error: %v)", startCtx.Err(), err)
+        case <-appCtx.Done():
+            timer.Stop()
+            return fmt.Errorf("%w (last error: %v)", appCtx.Err(), err)
+        }
+        if backoff *= 2; backoff > maxPingBackoff {
+            backoff = maxPingBackoff
+        }
+    }
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "database/sql/driver"
+    "errors"
+    "sync"
+    "testing"
+
+    "go.uber.org/fx"
+)
+
+// testDriverName is the database/sql driver the tests register: a database
+// that answers pings and nothing else. Each DSN can be given its own ping
+// with onPing.
+const testDriverName = "inject-test"
+
+func init() {
+    sql.Register(testDriverName, testDriver{})
+}
+
+var testPings sync.Map // DSN -> func() error
+
+// onPing makes pings of the test database named dsn call ping.
+func onPing(dsn string, ping func() error) {
+    testPings.Store(dsn, ping)
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+    return testConn{dsn}, nil
+}
+
+type testConn struct {
+    dsn string
+}
+
+func (c testConn) Ping(context.Context) error {
+    if ping, ok := testPings.Load(c.dsn); ok {
+        return ping.(func() error)()
+    }
+    return nil
+}
+
+func (testConn) Prepare(string) (driver.Stmt, error) {
+    return nil, errors.New("the test database only answers pings")
+}
+
+func (testConn) Close() error { return nil }
+
+func (testConn) Begin() (driver.Tx, error) {
+    return nil, errors.New("the test database only answers pings")
+}
+
+func TestDBReadyBeforeServer(t *testing.T) {
+    var app *testApp
+    var listeningAtPing bool
+    onPing(t.Name(), func() error {
+        listeningAtPing = app.listening()
+        return nil
+    })
+    app = newTestApp(t, func(c *AppConfig) {
+        c.DB = DBConfig{Driver: testDriverName, DSN: t.Name()}
+    }, fx.Provide(NewDBReady))
+    app.start()
+
+    if listeningAtPing {
+        t.Error("the HTTP server was listening before the database answered its ping")
+    }
+    if !app.listening() {
+        t.Error("the HTTP server isn't listening after startup")
+    }
+}
+
+func TestDBUnreachableStopsStartup(t *testing.T) {
+    onPing(t.Name(), func() error { return errors.New("connection refused") })
+    app := newTestApp(t, func(c *AppConfig) {
+        c.DB = DBConfig{Driver: testDriverName, DSN: t.Name(), PingAttempts: 1}
+    }, fx.Provide(NewDBReady))
+
+    if err := app.Start(t.Context()); err == nil {
+        t.Fatal("the application started with an unreachable database")
+    }
+    if app.listening() {
+        t.Error("the HTTP server started listening with an unreachable database")
+    }
+}
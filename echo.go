@@ -0,0 +1,45 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+)
+
+// NewEchoHandler constructs a /debug/echo route that describes the incoming
+// request - method, path, query, headers and request ID - as JSON. It's handy
+// for checking what a proxy or the middleware stack added to a request on its
+// way in.
+//
+// Like the pprof routes, it's only registered when AppConfig.EnablePprof is
+// set, on the server named by AppConfig.DebugServer: request headers can
+// carry credentials, so they shouldn't be echoed back in production. It's
+// provided through OptionalRoute as "echo".
+/*
+    NewEchoHandler 构造/debug/echo路由，以JSON描述传入的请求：方法、路径、查询参数、
+    请求头和请求ID。它便于检查代理或中间件栈在请求进入时添加了什么。
+
+    与pprof路由一样，只有在设置了AppConfig.EnablePprof时才会注册，挂载在
+    AppConfig.DebugServer指定的服务器上：请求头可能携带凭据，因此不应在生产环境中回显。
+    它通过OptionalRoute以"echo"之名提供。
+*/
+func NewEchoHandler(p DebugParams, logger *LeveledLogger) ([]Route, error) {
+    if !p.Config.EnablePprof {
+        return nil, nil
+    }
+    h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id, _ := RequestIDFrom(r.Context())
+        w.Header().Set("Content-Type", "application/json")
+        err := json.NewEncoder(w).Encode(struct {
+            Method     string              `json:"method"`
+            Path       string              `json:"path"`
+            Query      map[string][]string `json:"query"`
+            Headers    http.Header         `json:"headers"`
+            RemoteAddr string              `json:"remote_addr"`
+            RequestID  string              `json:"request_id,omitempty"`
+        }{r.Method, r.URL.Path, r.URL.Query(), r.Header, r.RemoteAddr, id})
+        if err != nil {
+            logger.Errorf("Writing echo response: %v", err)
+        }
+    })
+    return p.mount(Route{Path: "/debug/echo", Handler: h})
+}
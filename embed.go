@@ -0,0 +1,62 @@
+package main
+
+import (
+    "log"
+    "net/http"
+
+    "go.uber.org/fx"
+)
+
+// Embedded holds the values NewEmbedded pulls out of the graph for a program
+// that uses this server as a library rather than running it as main does.
+/*
+    Embedded 保存NewEmbedded从依赖图中取出的值，供将该服务器作为库使用（而不是像main
+    那样运行它）的程序使用。
+*/
+type Embedded struct {
+    // App is the application the values came from. Its lifecycle hooks -
+    // the servers' listeners, the database, background sweepers - only run
+    // once it's started.
+    App *fx.App
+    // Mux is the default server's mux, with every route already registered.
+    Mux *http.ServeMux
+    // Logger is the standard library logger the application logs through.
+    Logger *log.Logger
+}
+
+// NewEmbedded builds HTTPModule, plus opts, and hands back the mux and the
+// logger for the caller to use as it sees fit: mounting the mux under a
+// prefix on a server of its own, say, or logging through the same logger.
+//
+// fx.Populate is what gets them out. It's an invocation like any other,
+// requesting the types of the pointers it's given and storing the values Fx
+// builds for them, so they're filled in by the time fx.New returns - before
+// the application is started, if it ever is. Prefer Populate when the values
+// are needed outside the graph, by code Fx doesn't call; prefer Invoke when
+// the work that needs them can run inside it, as Register does, where it
+// gets its dependencies declared and its errors reported like every other
+// function in the graph. Populate is also convenient in tests, to reach into
+// an application and inspect a value.
+/*
+    NewEmbedded 构建HTTPModule及opts，并将mux和logger交还给调用方自行使用：例如把mux
+    挂载到调用方自己服务器的某个前缀下，或者通过同一个logger记录日志。
+
+    取出它们的是fx.Populate。它和其他invocation一样，请求所给指针的类型并保存Fx为其
+    构建的值，因此在fx.New返回时这些值就已经填好了——早于应用程序启动（如果它会被启动的
+    话）。当依赖图之外、不由Fx调用的代码需要这些值时，优先使用Populate；当需要它们的
+    工作可以在依赖图内部运行时（如Register那样），优先使用Invoke，这样它的依赖会被声明，
+    错误也会像依赖图中其他函数一样被报告。Populate在测试中也很方便，可以深入应用程序
+    检查某个值。
+*/
+func NewEmbedded(opts ...fx.Option) (*Embedded, error) {
+    var e Embedded
+    app, err := newApp(append([]fx.Option{
+        HTTPModule,
+        fx.Populate(&e.Mux, &e.Logger),
+    }, opts...)...)
+    if err != nil {
+        return nil, err
+    }
+    e.App = app
+    return &e, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "net/http"
+    "sort"
+    "sync/atomic"
+    "time"
+
+    "go.uber.org/fx"
+)
+
+// NewHealthHandler constructs the /healthz route used by liveness and
+// readiness probes. It reports 200 while the application is running and 503
+// otherwise.
+//
+// Like NewMux, it uses the Lifecycle rather than doing any work itself: the
+// ready flag flips to true in OnStart and back to false in OnStop, so probes
+// start failing as soon as shutdown begins.
+/*
+    NewHealthHandler 构造供存活和就绪探针使用的/healthz路由。应用程序运行时返回200，
+    否则返回503。
+
+    与NewMux一样，它使用Lifecycle而不是自己做任何工作：ready标志在OnStart中变为true，
+    在OnStop中变回false，因此一旦开始关闭，探针就会开始失败。
+*/
+func NewHealthHandler(lc fx.Lifecycle) RouteResult {
+    var ready atomic.Bool
+    lc.Append(fx.Hook{
+        OnStart: func(context.Context) error {
+            ready.Store(true)
+            return nil
+        },
+        OnStop: func(context.Context) error {
+            ready.Store(false)
+            return nil
+        },
+    })
+
+    return RouteResult{Route: Route{
+        Path: "/healthz",
+        Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+            if !ready.Load() {
+                w.WriteHeader(http.StatusServiceUnavailable)
+                return
+            }
+            w.WriteHeader(http.StatusOK)
+        }),
+    }}
+}
+
+// readinessTimeout bounds each readiness check, so one hung dependency can't
+// hang the probe.
+const readinessTimeout = 2 * time.Second
+
+// HealthCheck is a named check of a downstream dependency. Check returns nil
+// when the dependency is healthy.
+/*
+    HealthCheck 是对下游依赖项的命名检查。依赖项健康时Check返回nil。
+*/
+type HealthCheck struct {
+    Name  string
+    Check func(context.Context) error
+}
+
+// HealthCheckResult adds a HealthCheck to the "health_checks" value group, so
+// any module can contribute checks to /readyz.
+/*
+    HealthCheckResult 将HealthCheck添加到"health_checks"值组中，因此任何模块都可以向
+    /readyz提供检查。
+*/
+type HealthCheckResult struct {
+    fx.Out
+
+    Check HealthCheck `group:"health_checks"`
+}
+
+// ReadinessParams are NewReadinessHandler's dependencies.
+type ReadinessParams struct {
+    fx.In
+
+    Checks []HealthCheck `group:"health_checks"`
+}
+
+// NewReadinessHandler constructs the /readyz route. Unlike /healthz, which
+// only says the process is up, it runs every check in the "health_checks"
+// group and reports 200 only when all of them pass, 503 otherwise. The body
+// lists each check's result:
+//
+//   {"status":"unavailable","checks":{"db":"dial tcp: connection refused"}}
+/*
+    NewReadinessHandler 构造/readyz路由。与仅表示进程存活的/healthz不同，它运行
+    "health_checks"组中的每个检查，只有全部通过时才返回200，否则返回503。响应体列出
+    每个检查的结果：
+
+      {"status":"unavailable","checks":{"db":"dial tcp: connection refused"}}
+*/
+func NewReadinessHandler(p ReadinessParams) RouteResult {
+    checks := append([]HealthCheck(nil), p.Checks...)
+    sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+    return RouteResult{Route: Route{
+        Path: "/readyz",
+        Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            status, code := "ok", http.StatusOK
+            results := make(map[string]string, len(checks))
+            for _, c := range checks {
+                ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+                err := c.Check(ctx)
+                cancel()
+                if err != nil {
+                    status, code = "unavailable", http.StatusServiceUnavailable
+                    results[c.Name] = err.Error()
+                    continue
+                }
+                results[c.Name] = "ok"
+            }
+            w.Header().Set("Content-Type", "application/json")
+            w.WriteHeader(code)
+            json.NewEncoder(w).Encode(struct {
+                Status string            `json:"status"`
+                Checks map[string]string `json:"checks"`
+            }{status, results})
+        }),
+    }}
+}
+
+// NewDBHealthCheck contributes a readiness check that pings the database.
+// It isn't part of HTTPModule, since it makes the application depend on a
+// database; provide it alongside NewDB in applications that use one.
+/*
+    NewDBHealthCheck 提供一个ping数据库的就绪检查。由于它会让应用程序依赖数据库，因此
+    不属于HTTPModule；在使用数据库的应用程序中，将它与NewDB一起提供。
+*/
+func NewDBHealthCheck(db *sql.DB) HealthCheckResult {
+    return HealthCheckResult{Check: HealthCheck{Name: "db", Check: db.PingContext}}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "fmt"
+    "sync"
+)
+
+// HookOrder records the order in which Lifecycle hooks run. Fx runs OnStart
+// hooks in the order their constructors ran, which follows dependencies:
+// NewLogger's comes first, since NewDB and the HTTP servers both log through
+// it. NewDB's runs before the HTTP servers' only when NewMux takes a DBReady
+// (see NewDBReady); otherwise the servers usually start first, because NewMux
+// is built before the handlers that take a *sql.DB. OnStop hooks run in
+// reverse, so nothing is stopped while something still using it is running.
+// Constructors that register hooks note each one here, and Check confirms
+// the stop order mirrored the start order.
+/*
+    HookOrder 记录Lifecycle hooks的运行顺序。Fx按构造函数的运行顺序运行OnStart hooks，
+    这一顺序遵循依赖关系：NewLogger的hook最先运行，因为NewDB和HTTP服务器都通过它记录
+    日志。只有当NewMux接收DBReady时（见NewDBReady），NewDB的hook才会先于HTTP服务器的
+    hook运行；否则服务器通常先启动，因为NewMux在接收*sql.DB的handlers之前构建。OnStop
+    hooks按相反顺序运行，这样在还有使用者运行时，任何东西都不会被停止。注册hooks的构造
+    函数会在这里记录每个hook，Check用来确认停止顺序与启动顺序相反。
+*/
+type HookOrder struct {
+    mu      sync.Mutex
+    started []string
+    stopped []string
+}
+
+// NewHookOrder constructs an empty HookOrder.
+func NewHookOrder() *HookOrder {
+    return &HookOrder{}
+}
+
+// Start records that name's OnStart hook ran, returning its 1-based position.
+func (o *HookOrder) Start(name string) int {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    o.started = append(o.started, name)
+    return len(o.started)
+}
+
+// Stop records that name's OnStop hook ran, returning its 1-based position.
+func (o *HookOrder) Stop(name string) int {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    o.stopped = append(o.stopped, name)
+    return len(o.stopped)
+}
+
+// Started returns the names of the OnStart hooks that have run, in order.
+func (o *HookOrder) Started() []string {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    return append([]string(nil), o.started...)
+}
+
+// Stopped returns the names of the OnStop hooks that have run, in order.
+func (o *HookOrder) Stopped() []string {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    return append([]string(nil), o.stopped...)
+}
+
+// Check returns an error, reporting both orders, unless the OnStop hooks ran
+// in exactly the reverse of the OnStart order.
+func (o *HookOrder) Check() error {
+    o.mu.Lock()
+    defer o.mu.Unlock()
+    want := make([]string, len(o.started))
+    for i, name := range o.started {
+        want[len(want)-1-i] = name
+    }
+    ok := len(o.stopped) == len(want)
+    for i := 0; ok && i < len(want); i++ {
+        ok = o.stopped[i] == want[i]
+    }
+    if !ok {
+        return fmt.Errorf("hooks stopped in order %q, want the reverse of start order %q", o.stopped, o.started)
+    }
+    return nil
+}
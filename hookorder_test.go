@@ -0,0 +1,36 @@
+package main
+
+import (
+    "slices"
+    "testing"
+
+    "go.uber.org/fx"
+)
+
+func TestHooksStopInReverseStartOrder(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) {
+        c.DB = DBConfig{Driver: testDriverName, DSN: t.Name()}
+    }, fx.Provide(NewDBReady)).start()
+    app.stop()
+
+    want := []string{"logger", "db", "HTTP servers"}
+    if got := app.order.Started(); !slices.Equal(got, want) {
+        t.Errorf("hooks started in order %q, want %q", got, want)
+    }
+    if err := app.order.Check(); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestHookOrderCheck(t *testing.T) {
+    o := NewHookOrder()
+    for _, name := range []string{"logger", "db", "HTTP servers"} {
+        o.Start(name)
+    }
+    for _, name := range []string{"db", "HTTP servers", "logger"} {
+        o.Stop(name)
+    }
+    if err := o.Check(); err == nil {
+        t.Error("Check accepted hooks stopped out of order")
+    }
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "sync"
+)
+
+// InFlight counts the requests currently being handled. Server.Shutdown
+// already waits for connections to go idle, but an explicit counter lets us
+// expose the number for observability and confirm that drains complete.
+/*
+    InFlight 统计当前正在处理的请求。Server.Shutdown已经会等待连接变为空闲，但显式的
+    计数器让我们可以对外暴露这个数字以便观测，并确认排空确实完成。
+*/
+type InFlight struct {
+    mu    sync.Mutex
+    count int64
+    // idle is closed whenever count is zero, and replaced by an open channel
+    // when a request arrives at an idle counter.
+    idle chan struct{}
+}
+
+// NewInFlight constructs an empty InFlight counter.
+func NewInFlight() *InFlight {
+    idle := make(chan struct{})
+    close(idle)
+    return &InFlight{idle: idle}
+}
+
+// Count returns the number of requests currently in flight.
+func (f *InFlight) Count() int64 {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.count
+}
+
+// Wait blocks until no request is in flight or ctx is done, whichever comes
+// first. Every server shares the counter, and requests may keep arriving
+// while one of them waits, so it waits for a moment when the count is zero
+// rather than for a fixed set of requests.
+func (f *InFlight) Wait(ctx context.Context) error {
+    for {
+        f.mu.Lock()
+        idle := f.idle
+        f.mu.Unlock()
+        select {
+        case <-idle:
+            // A request may have arrived since; look again.
+            if f.Count() == 0 {
+                return nil
+            }
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+}
+
+func (f *InFlight) add(delta int64) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    if f.count == 0 && delta > 0 {
+        f.idle = make(chan struct{})
+    }
+    f.count += delta
+    if f.count == 0 {
+        close(f.idle)
+    }
+}
+
+// track counts each request to next for as long as it runs.
+func (f *InFlight) track(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        f.add(1)
+        defer f.add(-1)
+        next.ServeHTTP(w, r)
+    })
+}
+
+// NewInFlightMiddleware contributes the middleware that counts requests. It
+// wraps just inside the security-headers and metadata middleware, which only
+// set headers and seed the context, so the count covers everything else the
+// request does.
+func NewInFlightMiddleware(f *InFlight) MiddlewareResult {
+    return MiddlewareResult{Middleware: Middleware{
+        Name:     "in-flight",
+        Priority: PriorityInFlight,
+        Wrap:     f.track,
+    }}
+}
+
+// NewInFlightHandler constructs the /debug/inflight route, reporting the
+// current number of in-flight requests as {"inflight":N}.
+/*
+    NewInFlightHandler 构造/debug/inflight路由，以{"inflight":N}的形式报告当前进行中
+    的请求数。
+*/
+func NewInFlightHandler(f *InFlight) RouteResult {
+    return RouteResult{Route: Route{
+        Path: "/debug/inflight",
+        Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(struct {
+                InFlight int64 `json:"inflight"`
+            }{f.Count()})
+        }),
+    }}
+}
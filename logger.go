@@ -0,0 +1,408 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "log/slog"
+    "os"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+
+    "go.uber.org/fx"
+    "gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Level is the severity of a log line. Lines below the logger's configured
+// level are dropped.
+/*
+    Level 是日志的严重级别。低于logger配置级别的日志将被丢弃。
+*/
+type Level int
+
+const (
+    LevelDebug Level = iota
+    LevelInfo
+    LevelWarn
+    LevelError
+)
+
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+    if l < LevelDebug || l > LevelError {
+        return fmt.Sprintf("Level(%d)", int(l))
+    }
+    return levelNames[l]
+}
+
+// slogLevel maps l to the matching log/slog level.
+func (l Level) slogLevel() slog.Level {
+    switch l {
+    case LevelDebug:
+        return slog.LevelDebug
+    case LevelWarn:
+        return slog.LevelWarn
+    case LevelError:
+        return slog.LevelError
+    default:
+        return slog.LevelInfo
+    }
+}
+
+// UnmarshalText lets a Level be written by name in config files. Unlike
+// ParseLevel, it rejects names it doesn't know, so a typo fails loading the
+// configuration instead of quietly logging at INFO.
+func (l *Level) UnmarshalText(text []byte) error {
+    level, err := parseLevel(string(text))
+    if err != nil {
+        return err
+    }
+    *l = level
+    return nil
+}
+
+// ParseLevel maps the LOG_LEVEL names (DEBUG, INFO, WARN, ERROR) to a Level.
+// Matching is case-insensitive; unset or unrecognized names yield LevelInfo.
+/*
+    ParseLevel 将LOG_LEVEL的名称（DEBUG, INFO, WARN, ERROR）映射为Level。匹配不区分
+    大小写；未设置或无法识别的名称返回LevelInfo。
+*/
+func ParseLevel(name string) Level {
+    level, _ := parseLevel(name)
+    return level
+}
+
+// parseLevel is ParseLevel, with an error for a name that isn't a level.
+// An empty name is unset, and means LevelInfo.
+func parseLevel(name string) (Level, error) {
+    switch strings.ToUpper(strings.TrimSpace(name)) {
+    case "DEBUG":
+        return LevelDebug, nil
+    case "", "INFO":
+        return LevelInfo, nil
+    case "WARN":
+        return LevelWarn, nil
+    case "ERROR":
+        return LevelError, nil
+    default:
+        return LevelInfo, fmt.Errorf("unknown log level %q: must be DEBUG, INFO, WARN or ERROR", name)
+    }
+}
+
+// LoggerOutput is where NewLogger writes. It wraps io.Writer so that providing
+// a log destination can't be confused with any other io.Writer in the graph:
+// tests can supply a buffer, production a file.
+/*
+    LoggerOutput 是NewLogger写入的目标。它包装了io.Writer，这样提供日志目标时就不会与
+    依赖图中的其他io.Writer混淆：测试可以提供缓冲区，生产环境可以提供文件。
+*/
+type LoggerOutput struct {
+    io.Writer
+}
+
+// NewLoggerOutput constructs the LoggerOutput: standard output, unless
+// LoggerConfig.File names a log file. The file is rotated once it reaches
+// MaxSizeMB, keeping MaxBackups old files for up to MaxAgeDays, for
+// environments without an external logrotate; the OnStop hook closes it.
+// Since the logger depends on its output, that hook runs after every other,
+// so the last lines of shutdown still make it into the file.
+/*
+    NewLoggerOutput 构造LoggerOutput：标准输出，除非LoggerConfig.File指定了日志文件。
+    文件达到MaxSizeMB后会被轮转，最多保留MaxBackups个旧文件，最长保留MaxAgeDays天，
+    适用于没有外部logrotate的环境；OnStop hook会关闭它。由于logger依赖其输出，该hook
+    在所有其他hook之后运行，因此关闭过程的最后几行仍会写入文件。
+*/
+func NewLoggerOutput(lc fx.Lifecycle, cfg LoggerConfig) LoggerOutput {
+    if cfg.File == "" {
+        return LoggerOutput{Writer: os.Stdout}
+    }
+    file := &lumberjack.Logger{
+        Filename:   cfg.File,
+        MaxSize:    cfg.MaxSizeMB,
+        MaxBackups: cfg.MaxBackups,
+        MaxAge:     cfg.MaxAgeDays,
+    }
+    lc.Append(fx.Hook{
+        OnStop: func(context.Context) error {
+            return file.Close()
+        },
+    })
+    return LoggerOutput{Writer: file}
+}
+
+// NewStdLogger constructs the standard library logger NewLogger wraps,
+// writing to out with cfg.Flags. JSON lines carry their own timestamp, so in
+// the JSON format the flags are ignored.
+/*
+    NewStdLogger 构造NewLogger所包装的标准库logger，使用cfg.Flags写入out。JSON行自带
+    时间戳，因此JSON格式下会忽略这些标志。
+*/
+func NewStdLogger(cfg LoggerConfig, out LoggerOutput) *log.Logger {
+    flags := int(cfg.Flags)
+    if cfg.Format == LogFormatJSON {
+        flags = 0
+    }
+    return log.New(out, "" /* prefix */, flags)
+}
+
+// Log formats understood by LeveledLogger.
+const (
+    LogFormatText = "text"
+    LogFormatJSON = "json"
+)
+
+// Log backends, selected by LoggerConfig.Backend.
+const (
+    LogBackendLog  = "log"
+    LogBackendSlog = "slog"
+)
+
+// LeveledLogger wraps the standard library's logger, which has no notion of
+// severity, and drops calls below its threshold. In the JSON format each line
+// is serialized as {"ts":...,"level":...,"msg":...}; otherwise the message is
+// written as-is.
+//
+// With the LogBackendSlog backend, lines go through a *slog.Logger instead,
+// whose text or JSON handler writes to the same destination. Slog exposes
+// that logger, so code that wants structured key/value attributes can log
+// them directly.
+/*
+    LeveledLogger 包装了标准库的logger（它没有严重级别的概念），并丢弃低于阈值的调用。
+    在JSON格式下，每一行都被序列化为{"ts":...,"level":...,"msg":...}；否则按原样写出
+    消息。
+
+    使用LogBackendSlog后端时，日志改为经过一个*slog.Logger，其文本或JSON handler写入
+    同一个目标。Slog暴露该logger，因此需要结构化键值属性的代码可以直接使用它记录。
+*/
+type LeveledLogger struct {
+    logger *log.Logger
+    level  *atomic.Int32
+    json   bool
+    // fields tag every line, for loggers derived with With.
+    fields []logField
+
+    // slog and slogLevel are set only with the LogBackendSlog backend.
+    slog      *slog.Logger
+    slogLevel *slog.LevelVar
+}
+
+// NewLeveledLogger wraps logger so that only lines at or above cfg.Level are
+// written, in cfg.Format. With the LogBackendSlog backend, the slog handler
+// writes to logger's destination; logger's flags and prefix go unused.
+func NewLeveledLogger(logger *log.Logger, cfg LoggerConfig) *LeveledLogger {
+    l := &LeveledLogger{
+        logger: logger,
+        level:  new(atomic.Int32),
+        json:   cfg.Format == LogFormatJSON,
+    }
+    if cfg.Backend == LogBackendSlog {
+        l.slogLevel = new(slog.LevelVar)
+        opts := &slog.HandlerOptions{Level: l.slogLevel}
+        var h slog.Handler = slog.NewTextHandler(logger.Writer(), opts)
+        if l.json {
+            h = slog.NewJSONHandler(logger.Writer(), opts)
+        }
+        l.slog = slog.New(h)
+    }
+    l.SetLevel(cfg.Level)
+    return l
+}
+
+type logField struct {
+    key, value string
+}
+
+// With returns a logger that tags each line with key=value, on top of any
+// tags l already has. It writes through l, at l's level: SetLevel on either
+// changes both.
+/*
+    With 返回一个logger，它在l已有标签的基础上为每一行加上key=value标签。它经由l写出，
+    使用l的级别：对任一个调用SetLevel都会同时改变两者。
+*/
+func (l *LeveledLogger) With(key, value string) *LeveledLogger {
+    d := *l
+    d.fields = append(append([]logField(nil), l.fields...), logField{key, value})
+    if l.slog != nil {
+        d.slog = l.slog.With(key, value)
+    }
+    return &d
+}
+
+// SetLevel changes the threshold while the logger is in use.
+func (l *LeveledLogger) SetLevel(level Level) {
+    l.level.Store(int32(level))
+    if l.slogLevel != nil {
+        l.slogLevel.Set(level.slogLevel())
+    }
+}
+
+// Slog returns the *slog.Logger behind l, or nil unless l uses the
+// LogBackendSlog backend. It honours the same threshold as l, including
+// changes made with SetLevel.
+func (l *LeveledLogger) Slog() *slog.Logger {
+    return l.slog
+}
+
+// Level returns the current threshold.
+func (l *LeveledLogger) Level() Level {
+    return Level(l.level.Load())
+}
+
+func (l *LeveledLogger) enabled(level Level) bool {
+    return level >= Level(l.level.Load())
+}
+
+func (l *LeveledLogger) Debug(v ...interface{}) { l.print(LevelDebug, v...) }
+func (l *LeveledLogger) Info(v ...interface{})  { l.print(LevelInfo, v...) }
+func (l *LeveledLogger) Warn(v ...interface{})  { l.print(LevelWarn, v...) }
+func (l *LeveledLogger) Error(v ...interface{}) { l.print(LevelError, v...) }
+
+func (l *LeveledLogger) Debugf(format string, v ...interface{}) { l.printf(LevelDebug, format, v...) }
+func (l *LeveledLogger) Infof(format string, v ...interface{})  { l.printf(LevelInfo, format, v...) }
+func (l *LeveledLogger) Warnf(format string, v ...interface{})  { l.printf(LevelWarn, format, v...) }
+func (l *LeveledLogger) Errorf(format string, v ...interface{}) { l.printf(LevelError, format, v...) }
+
+func (l *LeveledLogger) print(level Level, v ...interface{}) {
+    if !l.enabled(level) {
+        return
+    }
+    l.output(level, fmt.Sprint(v...))
+}
+
+func (l *LeveledLogger) printf(level Level, format string, v ...interface{}) {
+    if !l.enabled(level) {
+        return
+    }
+    l.output(level, fmt.Sprintf(format, v...))
+}
+
+type jsonLine struct {
+    TS    string `json:"ts"`
+    Level string `json:"level"`
+    Msg   string `json:"msg"`
+}
+
+// StdLogger returns a standard library logger whose output goes through l at
+// level, for APIs such as http.Server.ErrorLog that only accept a
+// *log.Logger. Each line is written with prefix, and formatted as text or JSON
+// like any other line from l.
+/*
+    StdLogger 返回一个标准库logger，其输出以level级别经过l，用于http.Server.ErrorLog
+    等只接受*log.Logger的API。每一行都带有prefix，并像l的其他日志一样格式化为文本或JSON。
+*/
+func (l *LeveledLogger) StdLogger(level Level, prefix string) *log.Logger {
+    return log.New(levelWriter{l, level}, prefix, 0)
+}
+
+// levelWriter writes each line it's given to a LeveledLogger at one level.
+type levelWriter struct {
+    l     *LeveledLogger
+    level Level
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+    if w.l.enabled(w.level) {
+        w.l.output(w.level, strings.TrimSuffix(string(p), "\n"))
+    }
+    return len(p), nil
+}
+
+// callDepth is the number of stack frames between a caller of Info (or any
+// other level method) and the call to log.Logger.Output, so that Lshortfile
+// and Llongfile report the caller rather than this file.
+const callDepth = 4
+
+func (l *LeveledLogger) output(level Level, msg string) {
+    if l.slog != nil {
+        l.slog.Log(context.Background(), level.slogLevel(), msg)
+        return
+    }
+    if !l.json {
+        l.logger.Output(callDepth, l.tags()+msg)
+        return
+    }
+    b, err := json.Marshal(jsonLine{
+        TS:    time.Now().UTC().Format(time.RFC3339Nano),
+        Level: level.String(),
+        Msg:   msg,
+    })
+    if err != nil {
+        // Marshaling three strings can't fail, but don't lose the line if it does.
+        l.logger.Output(callDepth, l.tags()+msg)
+        return
+    }
+    // Fields go after ts, level and msg, as extra members of the object.
+    for _, f := range l.fields {
+        k, _ := json.Marshal(f.key)
+        v, _ := json.Marshal(f.value)
+        b = append(append(append(append(b[:len(b)-1], ','), k...), ':'), v...)
+        b = append(b, '}')
+    }
+    l.logger.Output(callDepth, string(b))
+}
+
+// tags formats l's fields for the start of a text line.
+func (l *LeveledLogger) tags() string {
+    if len(l.fields) == 0 {
+        return ""
+    }
+    var b strings.Builder
+    b.WriteByte('[')
+    for i, f := range l.fields {
+        if i > 0 {
+            b.WriteByte(' ')
+        }
+        b.WriteString(f.key + "=" + f.value)
+    }
+    b.WriteString("] ")
+    return b.String()
+}
+
+// LogFlags are log.Logger flags (log.Ldate, log.Lshortfile and so on). In
+// config files they're written by name, separated by "|" - for example
+// "date|time|shortfile" - or as a plain number; 0 (or "none") turns them all
+// off.
+/*
+    LogFlags 是log.Logger的标志（log.Ldate、log.Lshortfile等）。在配置文件中按名称书写，
+    以"|"分隔，例如"date|time|shortfile"，或者写成普通数字；0（或"none"）关闭所有标志。
+*/
+type LogFlags int
+
+// DefaultLogFlags stamps each line with the date, time and calling file.
+const DefaultLogFlags = LogFlags(log.LstdFlags | log.Lshortfile)
+
+var logFlagNames = map[string]int{
+    "none":         0,
+    "date":         log.Ldate,
+    "time":         log.Ltime,
+    "microseconds": log.Lmicroseconds,
+    "longfile":     log.Llongfile,
+    "shortfile":    log.Lshortfile,
+    "utc":          log.LUTC,
+    "msgprefix":    log.Lmsgprefix,
+    "std":          log.LstdFlags,
+}
+
+// UnmarshalText parses flag names or a number, as described on LogFlags.
+func (f *LogFlags) UnmarshalText(text []byte) error {
+    s := strings.TrimSpace(string(text))
+    if n, err := strconv.Atoi(s); err == nil {
+        *f = LogFlags(n)
+        return nil
+    }
+    var flags int
+    for _, name := range strings.Split(s, "|") {
+        v, ok := logFlagNames[strings.ToLower(strings.TrimSpace(name))]
+        if !ok {
+            return fmt.Errorf("unknown log flag %q", name)
+        }
+        flags |= v
+    }
+    *f = LogFlags(flags)
+    return nil
+}
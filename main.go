@@ -1,23 +1,52 @@
 package main
 
 import (
+    "bytes"
     "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
     "log"
+    "net"
     "net/http"
     "os"
+    "sort"
+    "strings"
     "time"
 
     "go.uber.org/fx"
+    "golang.org/x/net/http2"
+    "golang.org/x/net/http2/h2c"
 )
 
 // NewLogger constructs a logger. It's just a regular Go function, without any
 // special relationship to Fx.
 //
-// Since it returns a *log.Logger, Fx will treat NewLogger as the constructor
-// function for the standard library's logger. (We'll see how to integrate
-// NewLogger into an Fx application in the main function.) Since NewLogger
-// doesn't have any parameters, Fx will infer that loggers don't depend on any
-// other types - we can create them from thin air.
+// The standard library's logger has no notion of severity, so NewLogger wraps
+// it in a LeveledLogger whose threshold and output format (plain text or JSON
+// lines) come from the LoggerConfig.
+//
+// Since it returns a *LeveledLogger, Fx will treat NewLogger as the constructor
+// function for our leveled logger. (We'll see how to integrate
+// NewLogger into an Fx application in the main function.) Since NewLogger's
+// only parameters are its LoggerConfig, the standard library logger it wraps
+// (built by NewStdLogger), and the Lifecycle and HookOrder it uses to mark its
+// place in startup and shutdown, Fx will infer that loggers don't depend on
+// anything else - so the logger's hooks are the first to start and the last
+// to stop.
+//
+// Because the *log.Logger is a value in the graph of its own, a test can swap
+// it out with fx.Decorate - say, for one writing to a buffer it can assert
+// on - without touching NewLogger or anything that uses the logger:
+//
+//   var buf bytes.Buffer
+//   app := fxtest.New(t,
+//       HTTPModule,
+//       fx.Decorate(func(*log.Logger) *log.Logger {
+//           return log.New(&buf, "", 0)
+//       }),
+//   )
 //
 // Fx calls constructors lazily, so NewLogger will only be called only if some
 // other function needs a logger. Once instantiated, the logger is cached and
@@ -28,9 +57,24 @@ import (
 /*
 	NewLogger 构造了一个logger,它只是常规的Go函数，与Fx没有任何特殊关系。
 
-	由于返回的是* log.Logger，Fx将把NewLogger视为标准库的logger的构造函数。 （我们将
-	了解如何集成由于NewLogger没有任何参数，因此Fx会推断出logger不依赖于任何其他类型-
-	所以我们可以凭空创建它们。
+	标准库的logger没有严重级别的概念，因此NewLogger将其包装为LeveledLogger，阈值和输出
+	格式（纯文本或JSON行）来自LoggerConfig。
+
+	由于返回的是* LeveledLogger，Fx将把NewLogger视为我们的分级logger的构造函数。 （我们将
+	了解如何集成）由于NewLogger仅有的参数是它的LoggerConfig、它所包装的标准库logger
+	（由NewStdLogger构建），以及用来标记其在启动和关闭中位置的Lifecycle和HookOrder，
+	因此Fx会推断出logger不依赖于任何其他类型，所以logger的hooks最先启动、最后停止。
+
+	由于*log.Logger本身就是依赖图中的一个值，测试可以使用fx.Decorate替换它（比如替换为
+	写入缓冲区的logger，以便对输出进行断言），而无需修改NewLogger或任何使用logger的地方：
+
+	  var buf bytes.Buffer
+	  app := fxtest.New(t,
+	      HTTPModule,
+	      fx.Decorate(func(*log.Logger) *log.Logger {
+	          return log.New(&buf, "", 0)
+	      }),
+	  )
 
 	Fx调用构造函数是慵懒的，所以只有在某些其他函数需要logger时才调用NewLogger。 一旦实
 	例化，logger便被缓存与复用-在应用程序内，它实际上是单例(设计模式的一种)。
@@ -38,15 +82,34 @@ import (
 	默认情况下，Fx应用程序仅允许每种类型使用一个构造函数。 有关此限制的解决方法，请参见
 	输入和输出类型的文档。
 */
-func NewLogger() *log.Logger {
-    logger := log.New(os.Stdout, "" /* prefix */, 0 /* flags */)
-    logger.Print("Executing NewLogger.")
+func NewLogger(cfg LoggerConfig, std *log.Logger, lc fx.Lifecycle, order *HookOrder) *LeveledLogger {
+    logger := NewLeveledLogger(std, cfg)
+    logger.Debug("Executing NewLogger.")
+    lc.Append(fx.Hook{
+        OnStart: func(context.Context) error {
+            logger.Debugf("OnStart #%d: logger.", order.Start("logger"))
+            return nil
+        },
+        OnStop: func(context.Context) error {
+            logger.Debugf("OnStop #%d: logger.", order.Stop("logger"))
+            return nil
+        },
+    })
     return logger
 }
 
-// NewHandler constructs a simple HTTP handler. Since it returns an
-// http.Handler, Fx will treat NewHandler as the constructor for the
-// http.Handler type.
+// NewHandler constructs a simple HTTP handler that answers every request to
+// "/" with {"status":"ok","message":...}, where the message is the greeting
+// from AppConfig. It returns the handler as a Route, ready for Register to
+// mount.
+//
+// On its own, that would make NewHandler the constructor for the Route type -
+// and since Fx allows only one constructor per type, no other function could
+// provide a Route. HTTPModule gets around this by wrapping NewHandler with
+// fx.Annotate and fx.ResultTags(`group:"routes"`), which tells Fx to add the
+// Route to the "routes" value group instead. Any number of constructors can be
+// annotated the same way (NewEchoBodyHandler is a second one), and NewHandler
+// itself stays an ordinary function with no Fx types in its signature.
 //
 // Like many Go functions, NewHandler also returns an error. If the error is
 // non-nil, Go convention tells the caller to assume that NewHandler failed
@@ -56,7 +119,7 @@ func NewLogger() *log.Logger {
 //
 // Unlike NewLogger, NewHandler has formal parameters. Fx will interpret these
 // parameters as dependencies: in order to construct an HTTP handler,
-// NewHandler needs a logger. If the application has access to a *log.Logger
+// NewHandler needs a logger. If the application has access to a *LeveledLogger
 // constructor (like NewLogger above), it will use that constructor or its
 // cached output and supply a logger to NewHandler. If the application doesn't
 // know how to construct a logger and needs an HTTP handler, it will fail to
@@ -65,41 +128,145 @@ func NewLogger() *log.Logger {
 // Functions may also return multiple objects. For example, we could combine
 // NewHandler and NewLogger into a single function:
 //
-//   func NewHandlerAndLogger() (*log.Logger, http.Handler, error)
+//   func NewHandlerAndLogger() (*LeveledLogger, http.Handler, error)
 //
 // Fx also understands this idiom, and would treat NewHandlerAndLogger as the
-// constructor for both the *log.Logger and http.Handler types. Just like
+// constructor for both the *LeveledLogger and http.Handler types. Just like
 // constructors for a single type, NewHandlerAndLogger would be called at most
 // once, and both the handler and the logger would be cached and reused as
 // necessary.
 /*
-	NewHandler构造一个简单的HTTP handler。 由于返回了http.Handler，Fx将把NewHandler
-	视为http.Handler类型的构造函数。
+	NewHandler构造一个简单的HTTP handler，对"/"的每个请求都返回
+	{"status":"ok","message":...}，其中message是AppConfig中的问候语。它以Route的形式
+	返回handler，供Register挂载。
+
+	仅凭这一点，NewHandler会成为Route类型的构造函数，而由于Fx每种类型只允许一个构造
+	函数，其他函数就无法再提供Route。HTTPModule通过fx.Annotate和
+	fx.ResultTags(`group:"routes"`)包装NewHandler来绕过这一限制，告诉Fx将Route加入
+	"routes"值组。任意数量的构造函数都可以用同样的方式注解（NewEchoBodyHandler就是第二个），
+	而NewHandler本身仍然是签名中不含任何Fx类型的普通函数。
 
 	像许多Go函数一样，NewHandler也返回错误。 如果err不为nil，则Go规定将告诉调用者假定
 	为NewHandler失败，并且其他的返回值不能安全使用。 Fx理解了这个习惯用法，并假定最后一
 	个返回值是err的任何函数都遵循此约定。
 
 	与NewLogger不同，NewHandler具有形式参数。 Fx会将这些参数解释为依赖项：为了构造HTTP
-	Handler，NewHandler需要logger。 如果应用程序可以访问* log.Logger构造函数（如上述的
+	Handler，NewHandler需要logger。 如果应用程序可以访问* LeveledLogger构造函数（如上述的
 	NewLogger），它将使用该构造函数或其缓存的输出并将logger提供给NewHandler。 如果应用程
 	序不知道如何构造logger，并且需要HTTP处理程序，它将无法启动。
 
 	函数也可能返回多个对象。 例如，我们可以将NewHandler和NewLogger组合成一个函数：
-	  func NewHandlerAndLogger() (*log.Logger, http.Handler, error)
+	  func NewHandlerAndLogger() (*LeveledLogger, http.Handler, error)
 
-	Fx也理解这个习惯用法，并将NewHandlerAndLogger视为*log.Logger和http.Handler类型的
+	Fx也理解这个习惯用法，并将NewHandlerAndLogger视为*LeveledLogger和http.Handler类型的
 	构造函数。 就像单一类型的构造函数，NewHandlerAndLogger最多将被调用一次，Handler和
 	logger都将被缓存并根据需要重新使用。
 */
-func NewHandler(logger *log.Logger) (http.Handler, error) {
-    logger.Print("Executing NewHandler.")
-    return http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
-        logger.Print("Got a request.")
-    }), nil
+func NewHandler(logger *LeveledLogger, cfg AppConfig) (Route, error) {
+    logger.Info("Executing NewHandler.")
+    greeting := cfg.greeting()
+    h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        logger.Debug("Got a request.")
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(http.StatusOK)
+        err := json.NewEncoder(w).Encode(struct {
+            Status  string `json:"status"`
+            Message string `json:"message"`
+        }{"ok", greeting})
+        if err != nil {
+            logger.Errorf("Writing response: %v", err)
+        }
+    })
+    return Route{Path: "/", Handler: h}, nil
+}
+
+// NewEchoBodyHandler constructs a POST /echo route that writes the request body
+// back to the caller. It's the second handler constructor HTTPModule
+// annotates into the "routes" group, next to NewHandler.
+/*
+	NewEchoBodyHandler 构造POST /echo路由，将请求体原样写回调用方。它是HTTPModule注解进
+	"routes"值组的第二个handler构造函数，与NewHandler并列。
+*/
+func NewEchoBodyHandler(logger *LeveledLogger) Route {
+    h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if ct := r.Header.Get("Content-Type"); ct != "" {
+            w.Header().Set("Content-Type", ct)
+        }
+        if _, err := io.Copy(w, r.Body); err != nil {
+            logger.Errorf("Echoing request: %v", err)
+        }
+    })
+    return Route{Path: "/echo", Method: http.MethodPost, Handler: h}
 }
 
-// NewMux constructs an HTTP mux. Like NewHandler, it depends on *log.Logger.
+// MuxParams are NewMux's dependencies. Embedding fx.In tells Fx to fill in
+// each field as if it were a separate parameter, and lets us mark the
+// ServerConfig optional: when nobody provides one, NewMux falls back to
+// DefaultAddr. Likewise, without a TLSConfig the server speaks plaintext HTTP.
+//
+// Server is an escape hatch for http.Server fields ServerConfig doesn't cover
+// (TLSNextProto, BaseContext and so on): provide a *http.Server with those
+// set, and NewMux uses it instead of building its own, filling in only the
+// fields left at their zero values - Addr, Handler, the timeouts, ConnState
+// and ErrorLog - as usual.
+//
+// DBReady, when provided, makes the servers start only after the database
+// ping succeeds (see DBReady).
+/*
+	MuxParams 是NewMux的依赖项。嵌入fx.In会让Fx像对待单独参数一样填充每个字段，并允许
+	我们将ServerConfig标记为可选：当没有提供时，NewMux回退到DefaultAddr。同样，没有
+	TLSConfig时服务器使用明文HTTP。
+
+	Server为ServerConfig未涵盖的http.Server字段（TLSNextProto、BaseContext等）提供了
+	一个逃生通道：提供一个设置好这些字段的*http.Server，NewMux就会使用它而不是自己构建，
+	只像往常一样填充保持零值的字段：Addr、Handler、各项超时、ConnState和ErrorLog。
+
+	提供了DBReady时，服务器只会在数据库ping成功之后启动（参见DBReady）。
+*/
+type MuxParams struct {
+    fx.In
+
+    Lifecycle fx.Lifecycle
+    Context   context.Context
+    Logger    *LeveledLogger
+    InFlight  *InFlight
+    Servers   *ServerGroup
+    Conns     *ConnStats
+    Reload    *ReloadHooks
+    Config    ServerConfig `optional:"true"`
+    TLS       TLSConfig    `optional:"true"`
+    Server    *http.Server `optional:"true"`
+    Listen    ListenFunc   `optional:"true"`
+    DBReady   DBReady      `optional:"true"`
+}
+
+// ListenFunc opens the listener a server accepts connections on. NewMux uses
+// net.Listen unless one is provided, which lets integration tests bind an
+// ephemeral port instead of the configured address and find out which port
+// they got:
+//
+//   var ln net.Listener
+//   app := fxtest.New(t,
+//       HTTPModule,
+//       fx.Provide(func() ListenFunc {
+//           return func(network, _ string) (net.Listener, error) {
+//               l, err := net.Listen(network, "127.0.0.1:0")
+//               ln = l
+//               return l, err
+//           }
+//       }),
+//   )
+//   app.RequireStart()
+//   t.Cleanup(app.RequireStop)
+//   resp, err := http.Get("http://" + ln.Addr().String() + "/healthz")
+/*
+	ListenFunc 打开服务器接受连接所用的listener。除非提供了ListenFunc，否则NewMux使用
+	net.Listen。这样集成测试就可以绑定一个临时端口而不是配置的地址，并得知实际获得的
+	端口（示例见上）。
+*/
+type ListenFunc func(network, addr string) (net.Listener, error)
+
+// NewMux constructs an HTTP mux. Like NewHandler, it depends on *LeveledLogger.
 // However, it also depends on the Fx-specific Lifecycle interface.
 //
 // A Lifecycle is available in every Fx application. It lets objects hook into
@@ -128,7 +295,7 @@ func NewHandler(logger *log.Logger) (http.Handler, error) {
 // some other function wants to register a handler. This makes it easy to use
 // Fx's Lifecycle to start an HTTP server only if we have handlers registered.
 /*
-	NewMux构造一个HTTP mux。 与NewHandler一样，它依赖 *log.Logger，但是也依赖Fx
+	NewMux构造一个HTTP mux。 与NewHandler一样，它依赖 *LeveledLogger，但是也依赖Fx
 	特定的Lifecycle接口。
 
 	每个Fx应用程序都有一个生命周期。 它使对象可以hook进入应用程序的开始和停止阶段。 在
@@ -152,19 +319,86 @@ func NewHandler(logger *log.Logger) (http.Handler, error) {
 	非有其他函数想要注册的行为，否则不会调用NewMux。 只有当我们已注册处理程序时，这让
 	使用Fx的LifeSycle启动HTTP服务器变得容易。
 */
-func NewMux(lc fx.Lifecycle, logger *log.Logger) *http.ServeMux {
-    logger.Print("Executing NewMux.")
+func NewMux(p MuxParams) *http.ServeMux {
+    return newMux(p, "")
+}
+
+// newMux builds a mux and the server behind it, registering the server's
+// Lifecycle hooks. name identifies named servers (see NamedServer) in logs and
+// is empty for the default one.
+func newMux(p MuxParams, name string) *http.ServeMux {
+    lc, logger := p.Lifecycle, p.Logger
+    label := "HTTP server"
+    if name != "" {
+        label = name + " HTTP server"
+    }
+    logger.Infof("Executing NewMux for %s.", label)
     // First, we construct the mux and server. We don't want to start the server
 	// until all handlers are registered.
 	// 首先，我们构建mux和server。 在所有处理程序都注册之前，我们不希望启动服务器。
     mux := http.NewServeMux()
-    server := &http.Server{
-        Addr:    ":8080",
-        Handler: mux,
+    server := p.Server
+    if server == nil {
+        server = &http.Server{}
+    }
+    if server.Addr == "" {
+        server.Addr = p.Config.addr()
+    }
+    if server.ReadTimeout == 0 {
+        server.ReadTimeout = p.Config.ReadTimeout
+    }
+    if server.WriteTimeout == 0 {
+        server.WriteTimeout = p.Config.WriteTimeout
+    }
+    if server.IdleTimeout == 0 {
+        server.IdleTimeout = p.Config.IdleTimeout
+    }
+    if server.Handler == nil {
+        server.Handler = mux
+        // h2c only swaps the handler, so the server's timeouts and the
+        // Lifecycle hooks below apply to HTTP/2 connections just the same.
+        // h2c只替换handler，因此服务器的超时和下面的Lifecycle hooks同样适用于HTTP/2连接。
+        if p.Config.EnableH2C {
+            server.Handler = h2c.NewHandler(mux, &http2.Server{IdleTimeout: server.IdleTimeout})
+        }
+    }
+    // Errors net/http logs itself, such as failed TLS handshakes, go through
+    // our logger rather than straight to the standard logger.
+    // net/http自己记录的错误（例如TLS握手失败）经由我们的logger输出，而不是直接写入标准logger。
+    if server.ErrorLog == nil {
+        server.ErrorLog = logger.StdLogger(LevelError, label+": ")
+    }
+    // Request contexts derive from the application context, and are cancelled
+    // as soon as the server starts stopping. Shutdown still waits for
+    // handlers to return, for up to ShutdownTimeout, but handlers that watch
+    // their request's ctx.Done() can abort early instead of running out the
+    // clock; those that don't are cut off when the timeout forces a Close.
+    // 请求context派生自应用程序context，并在服务器开始停止时立即取消。Shutdown仍会
+    // 等待handlers返回（最多ShutdownTimeout），但关注请求ctx.Done()的handlers可以提前
+    // 中止，而不必耗尽时间；不关注的handlers会在超时强制Close时被切断。
+    baseCtx, cancelRequests := context.WithCancel(p.Context)
+    listen := p.Listen
+    if listen == nil {
+        listen = net.Listen
+        if p.Config.ReusePort && p.Config.network() != NetworkUnix {
+            if reusePortSupported {
+                listen = reusePortListen
+            } else {
+                logger.Warnf("SO_REUSEPORT isn't supported on this platform; %s listens without it.", label)
+            }
+        }
+    }
+    if server.BaseContext == nil {
+        server.BaseContext = func(net.Listener) context.Context { return baseCtx }
+    }
+    if server.ConnState == nil && p.Config.LogConnState {
+        server.ConnState = connStateHook(p.Conns.server(label), logger, label)
     }
     // If NewMux is called, we know that another function is using the mux. In
     // that case, we'll use the Lifecycle type to register a Hook that starts
-    // and stops our HTTP server.
+    // and stops our HTTP server. The hook goes through the ServerGroup, which
+    // registers one Lifecycle hook for all servers and runs theirs
+    // concurrently.
     //
     // Hooks are executed in dependency order. At startup, NewLogger's hooks run
     // before NewMux's. On shutdown, the order is reversed.
@@ -178,7 +412,8 @@ func NewMux(lc fx.Lifecycle, logger *log.Logger) *http.ServeMux {
 	// run the remaining hooks.
 	/*
 		如果NewMux被调用，我们知道另一个函数正在使用这个mux。 这种情况下，我们将使用
-		lifecycle类型注册一个用于启动和停止HTTP服务器的Hook。
+		lifecycle类型注册一个用于启动和停止HTTP服务器的Hook。该Hook经由ServerGroup注册，
+		它为所有服务器只注册一个Lifecycle hook，并发运行各服务器的hook。
 
 		hooks 按依赖关系顺序执行。 在启动时，NewLogger的hooks先于NewMux的hooks运行。 
 		关机时，顺序相反。
@@ -188,7 +423,18 @@ func NewMux(lc fx.Lifecycle, logger *log.Logger) *http.ServeMux {
 
 		从OnStop hooks 返回错误会记录警告，但是Fx继续运行其余的挂钩。
 	*/
-    lc.Append(fx.Hook{
+    var ln net.Listener
+    serveErr := make(chan error, 1)
+    // serveError returns the error Serve died with, if it did.
+    serveError := func() error {
+        select {
+        case err := <-serveErr:
+            return fmt.Errorf("serving %s on %s: %w", label, server.Addr, err)
+        default:
+            return nil
+        }
+    }
+    p.Servers.add(lc, label, server, fx.Hook{
         // To mitigate the impact of deadlocks in application startup and
         // shutdown, Fx imposes a time limit on OnStart and OnStop hooks. By
         // default, hooks have a total of 15 seconds to complete. Timeouts are
@@ -198,30 +444,183 @@ func NewMux(lc fx.Lifecycle, logger *log.Logger) *http.ServeMux {
 		默认情况下，挂钩总共需要15秒才能完成。 超时是通过Go的常规context.Context传递的。
 		*/
         OnStart: func(context.Context) error {
-            logger.Print("Starting HTTP server.")
-            // In production, we'd want to separate the Listen and Serve phases for
-			// better error-handling.
-			// 在生产中，我们希望将Listen和Server阶段分开以更好地处理错误。
-            go server.ListenAndServe()
+            logger.Infof("Starting %s.", label)
+            // We separate the Listen and Serve phases for better error-handling:
+            // binding synchronously means a failure (say, the port is already in
+            // use) is returned from OnStart and aborts startup, instead of being
+            // lost in the serving goroutine.
+            // 我们将Listen和Serve阶段分开以更好地处理错误：同步绑定意味着失败（比如端口
+            // 已被占用）会从OnStart返回并中止启动，而不是在服务goroutine中丢失。
+            //
+            // For the same reason, TLS certificates are loaded here rather than
+            // left for ServeTLS to discover missing or unreadable files.
+            // 出于同样的原因，TLS证书在这里加载，而不是留给ServeTLS去发现缺失或无法读取的文件。
+            //
+            // Errors are wrapped with the server and address they came from, so
+            // the message Fx finally reports identifies the failing component.
+            // 错误会附带其来源的服务器和地址，这样Fx最终报告的消息能够指明出错的组件。
+            useTLS := p.TLS.enabled()
+            if useTLS {
+                cfg, certs, err := p.TLS.load()
+                if err != nil {
+                    return fmt.Errorf("starting %s on %s: %w", label, server.Addr, err)
+                }
+                server.TLSConfig = cfg
+                if certs != nil {
+                    p.Reload.Add("TLS certificate for "+label, certs.reload)
+                }
+            }
+            var l net.Listener
+            var err error
+            if p.Config.network() == NetworkUnix {
+                l, err = listenUnix(listen, server.Addr)
+            } else {
+                l, err = listen(p.Config.network(), server.Addr)
+            }
+            if err != nil {
+                return fmt.Errorf("starting %s on %s: %w", label, server.Addr, err)
+            }
+            ln = l
+            // Report the address actually bound: the resolved host, and the
+            // port the OS picked if the configured one was 0.
+            // 报告实际绑定的地址：解析后的主机，以及配置端口为0时操作系统选择的端口。
+            logger.Infof("%s listening on %s %s.", label, l.Addr().Network(), l.Addr())
+            // Settled before Serve, so no connection is served with the
+            // other setting.
+            // 在Serve之前确定，因此不会有连接以另一种设置被服务。
+            keepAlives := !p.Config.DisableKeepAlives
+            server.SetKeepAlivesEnabled(keepAlives)
+            logger.Infof("%s keep-alives enabled: %t.", label, keepAlives)
+            // Serve only returns http.ErrServerClosed once Shutdown or Close
+            // is called, which is how it's meant to stop. Anything else means
+            // the server died underneath us: log it now, and hand it to OnStop
+            // so it isn't lost.
+            // Serve只有在调用Shutdown或Close后才返回http.ErrServerClosed，这是它正常
+            // 停止的方式。其他任何错误都意味着服务器意外终止：立即记录下来，并交给OnStop，
+            // 这样错误不会丢失。
+            go func() {
+                var err error
+                if useTLS {
+                    err = server.ServeTLS(ln, "", "")
+                } else {
+                    err = server.Serve(ln)
+                }
+                if err != nil && !errors.Is(err, http.ErrServerClosed) {
+                    logger.Errorf("%s on %s stopped serving: %v", label, server.Addr, err)
+                    serveErr <- err
+                }
+            }()
             return nil
         },
         OnStop: func(ctx context.Context) error {
-            logger.Print("Stopping HTTP server.")
-            return server.Shutdown(ctx)
+            logger.Infof("Stopping %s.", label)
+            // Unlink the socket file once the listener is closed. (Deferred
+            // calls run last-in first-out, so this runs after ln.Close.)
+            // 在listener关闭后删除socket文件。（defer按后进先出执行，因此它在ln.Close之后运行。）
+            if p.Config.network() == NetworkUnix {
+                defer func() {
+                    if err := removeSocket(server.Addr); err != nil {
+                        logger.Warnf("Removing socket for %s: %v", label, err)
+                    }
+                }()
+            }
+            // Shutdown closes the listener too; closing it again here just makes
+            // sure it's released even if Serve never got as far as tracking it.
+            defer ln.Close()
+            cancelRequests()
+            // Give in-flight requests a bounded grace period, whatever deadline
+            // the caller's stop context carries.
+            // 无论调用者的stop context带有什么截止时间，都为进行中的请求提供有限的宽限期。
+            if timeout := p.Config.ShutdownTimeout; timeout > 0 {
+                var cancel context.CancelFunc
+                ctx, cancel = context.WithTimeout(ctx, timeout)
+                defer cancel()
+            }
+            start := time.Now()
+            if err := server.Shutdown(ctx); err != nil {
+                // The deadline passed with requests still running: cut them off
+                // rather than leave the server half-stopped.
+                // 截止时间已过而请求仍在运行：强制切断它们，而不是让服务器处于半停止状态。
+                logger.Warnf("Shutdown deadline exceeded for %s after %s, forcing close.", label, time.Since(start))
+                server.Close()
+                // Don't lose an error Serve had already died with.
+                // 不要丢失Serve此前终止时的错误。
+                return errors.Join(fmt.Errorf("stopping %s on %s: %w", label, server.Addr, err), serveError())
+            }
+            logger.Infof("Graceful shutdown of %s complete in %dms.", label, time.Since(start).Milliseconds())
+            // Shutdown waits for connections to go idle; also wait for the
+            // handlers we counted, so a completed drain is confirmed explicitly.
+            // Shutdown会等待连接变为空闲；我们还会等待已计数的handlers，以明确确认排空已完成。
+            if err := p.InFlight.Wait(ctx); err != nil {
+                return errors.Join(fmt.Errorf("draining %s on %s: %w", label, server.Addr, err), serveError())
+            }
+            logger.Infof("Drained in-flight requests for %s.", label)
+            return serveError()
         },
     })
 
     return mux
 }
 
-// Register mounts our HTTP handler on the mux.
+// RegisterParams are Register's dependencies. The Routes field collects every
+// Route contributed to the "routes" value group, in no particular order,
+// Muxes collects the mux of every server added with NamedServer, and
+// Middleware collects the "middleware" group.
+/*
+	RegisterParams 是Register的依赖项。Routes字段收集所有提供给"routes"值组的Route，
+	顺序不定；Muxes收集通过NamedServer添加的每个服务器的mux；Middleware收集"middleware"组。
+*/
+type RegisterParams struct {
+    fx.In
+
+    Mux         *http.ServeMux
+    Logger      *LeveledLogger
+    Metrics     *Metrics
+    Config      MiddlewareConfig    `optional:"true"`
+    Live        *LiveConfig         `optional:"true"`
+    Concurrency *ConcurrencyLimiter `optional:"true"`
+    Cache       *ResponseCache      `optional:"true"`
+    Audit       *AuditLogger        `optional:"true"`
+    Routes      []Route             `group:"routes"`
+    Attempts    []RouteAttempt      `group:"route_attempts"`
+    Muxes       []NamedMux          `group:"muxes"`
+    Middleware  []Middleware        `group:"middleware"`
+}
+
+// noRoutesHandler is mounted on "/" when the application has no routes.
+var noRoutesHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+    WriteProblem(w, http.StatusNotFound, "", "The server is running, but no routes are registered.")
+})
+
+// Register mounts our HTTP handlers on the mux.
 //
 // Register is a typical top-level application function: it takes a generic
 // type like ServeMux, which typically comes from a third-party library, and
 // introduces it to a type that contains our application logic. In this case,
-// that introduction consists of registering an HTTP handler. Other typical
+// that introduction consists of registering HTTP handlers. Other typical
 // examples include registering RPC procedures and starting queue consumers.
 //
+// Fx fills value groups in an unspecified order, so Register sorts the routes
+// by path before mounting them to keep its logs stable. Each handler is
+// wrapped with the shared middleware (see WrapHandler) on the way in. Routes
+// naming a Server are mounted on that server's mux instead of the default one;
+// naming a server that doesn't exist is an error. Routes on the default
+// server are mounted under MiddlewareConfig.PathPrefix, if it's set. Routes that set a Method
+// only answer that method (and HEAD, for GET routes); several routes can share
+// a path as long as their methods differ. Two routes for the same method
+// and path are an error naming both handlers, or, with
+// MiddlewareConfig.DuplicateRoutes set to DuplicateRoutesWarn, a warning, in
+// which case the first route registered is kept.
+//
+// Optional routes (see OptionalRoute) are mounted alongside the "routes"
+// group if they built; one that didn't is logged and skipped, unless
+// MiddlewareConfig.RequiredRoutes names it, which makes its error Register's.
+//
+// Forgetting to provide any routes at all is an easy mistake that otherwise
+// just looks like a server answering 404 to everything, so Register warns
+// about it and, unless MiddlewareConfig.NoDefaultRoute is set, mounts a
+// placeholder on "/" saying so.
+//
 // Fx calls these functions invocations, and they're treated differently from
 // the constructor functions above. Their arguments are still supplied via
 // dependency injection and they may still return an error to indicate
@@ -230,76 +629,526 @@ func NewMux(lc fx.Lifecycle, logger *log.Logger) *http.ServeMux {
 // Unlike constructors, invocations are called eagerly. See the main function
 // below for details.
 /*
-	Register函数将我们的HTTP hander挂载在mux上。 
+	Register函数将我们的HTTP handlers挂载在mux上。 
 
 	Register是典型的顶级应用程序函数：它采用了ServeMux之类的通用类型，该类型通常来
 	自第三方库，并将其引入包含我们的应用程序逻辑的类型。 在这种情况下，该介绍包括注册
 	HTTP处理程序。 其他典型示例包括注册RPC过程和启动队列使用者。
 
+	Fx填充值组的顺序是不确定的，因此Register在挂载之前按路径对routes排序，以保持日志稳定。
+	每个handler在挂载时都会被共享的中间件包装（参见WrapHandler）。指定了Server的路由
+	会挂载到该服务器的mux上，而不是默认的mux；指定不存在的服务器会返回错误。
+	默认服务器上的路由在设置了MiddlewareConfig.PathPrefix时会挂载到该前缀下。设置了Method
+	的路由只响应该方法（GET路由还会响应HEAD）；只要方法不同，多个路由可以共享同一路径。
+	同一方法和路径的两个路由会导致一个指明两个handler的错误；如果
+	MiddlewareConfig.DuplicateRoutes设置为DuplicateRoutesWarn，则只记录警告并保留先注册的路由。
+
+	可选路由（参见OptionalRoute）构建成功时与"routes"值组一起挂载；构建失败的可选路由会被
+	记录并略过，除非MiddlewareConfig.RequiredRoutes列出了它，此时它的错误即为Register的错误。
+
+	完全忘记提供路由是一个容易犯的错误，否则看起来就像服务器对所有请求都返回404，因此
+	Register会对此发出警告，并且除非设置了MiddlewareConfig.NoDefaultRoute，否则会在"/"
+	上挂载一个说明这一情况的占位handler。
+
 	Fx调用这些函数调用，并且它们与上述构造函数的区别对待。 它们的参数仍通过依赖项注入
 	提供，并且它们仍可能返回错误以指示失败，但是任何其他返回值都将被忽略。
 
 	与构造函数不同，invocations 被急切地调用。 有关详细信息，请参见下面的主要功能。
 
 */
-func Register(mux *http.ServeMux, h http.Handler) {
-    mux.Handle("/", h)
+func Register(p RegisterParams) error {
+    muxes := map[string]*http.ServeMux{"": p.Mux}
+    for _, m := range p.Muxes {
+        muxes[m.Name] = m.Mux
+    }
+
+    routes, err := p.collectRoutes()
+    if err != nil {
+        return err
+    }
+    if len(routes) == 0 {
+        p.Logger.Warn("No routes were provided: did you forget to add a handler to the \"routes\" group?")
+        if !p.Config.NoDefaultRoute {
+            p.Mux.Handle("/", noRoutesHandler)
+        }
+        return nil
+    }
+
+    mws := sortMiddleware(p.Middleware)
+    sort.Slice(routes, func(i, j int) bool {
+        if routes[i].Path != routes[j].Path {
+            return routes[i].Path < routes[j].Path
+        }
+        return routes[i].Method < routes[j].Method
+    })
+
+    // Routes sharing a server and path share one mux entry, which dispatches
+    // on the request method.
+    type mount struct{ server, path string }
+    routers := make(map[mount]*methodRouter)
+    var order []mount
+    for _, r := range routes {
+        // Name the handler before withPrefix can wrap it.
+        name := handlerName(r.Handler)
+        r = r.withPrefix(p.Config)
+        if _, ok := muxes[r.Server]; !ok {
+            return fmt.Errorf("route %s: no server named %q", r.Path, r.Server)
+        }
+        m := mount{r.Server, r.Path}
+        router, ok := routers[m]
+        if !ok {
+            router = newMethodRouter()
+            routers[m] = router
+            order = append(order, m)
+        }
+        if err := router.add(r.Method, p.routeHandler(r), name); err != nil {
+            err = fmt.Errorf("route %s from %s: %w", r.describe(), name, err)
+            if p.Config.DuplicateRoutes != DuplicateRoutesWarn {
+                return err
+            }
+            p.Logger.Warnf("Ignoring duplicate %v.", err)
+            continue
+        }
+        if r.Server != "" {
+            p.Logger.Infof("Registering route %s on %s.", r.describe(), r.Server)
+        } else {
+            p.Logger.Infof("Registering route %s.", r.describe())
+        }
+    }
+    for _, m := range order {
+        h := applyMiddleware(routers[m].handler(), mws)
+        mux := muxes[m.server]
+        mux.Handle(m.path, trailingSlash(h, p.Config.TrailingSlash, m.path))
+        // A route registered for "/foo/" as well keeps its own handler.
+        // 同时注册了"/foo/"的路由保留它自己的handler。
+        if alias := slashAlias(m.path, p.Config.TrailingSlash); alias != "" && routers[mount{m.server, m.path + "/"}] == nil {
+            mux.Handle(alias, trailingSlash(h, p.Config.TrailingSlash, alias))
+        }
+    }
+    return nil
+}
+
+// HTTPModule bundles everything the HTTP server needs - its configuration,
+// logger, handlers, mux and the Register invocation - into a single option, so
+// an application can embed the whole stack with one line and compose it with
+// other modules.
+/*
+    HTTPModule 将HTTP服务器所需的一切（配置、logger、handlers、mux以及Register调用）
+    打包为单个选项，因此应用程序可以用一行代码嵌入整个栈，并与其他模块组合使用。
+*/
+var HTTPModule = fx.Module("http",
+    fx.Provide(NewLoggerOutput, NewStdLogger, NewLogger),
+    serverOptions,
+)
+
+// serverOptions is HTTPModule minus the constructors for the standard library
+// logger, which newAppWithLogger supplies itself.
+var serverOptions = fx.Options(
+    // Provide all the constructors we need, which teaches Fx how we'd like to
+    // construct the routes, the *http.ServeMux and everything they depend on.
+    // Remember that constructors are called lazily, so this block doesn't do
+    // much on its own.
+    /*
+    提供我们需要的所有构造函数，这将教给Fx我们如何构造路由、* http.ServeMux以及它们依赖
+    的一切。请记住，构造函数被懒惰地调用，因此，该块本身并不会做太多事情。
+    */
+    fx.Provide(
+        NewConfig,
+        NewComponentConfigs,
+        NewLiveConfig,
+        NewReloadHooks,
+        NewHookOrder,
+        NewServerGroup,
+        NewAppContext,
+        NewWorkerPool,
+        NewScheduler,
+        NewDB,
+        NewCircuitBreaker,
+        NewHTTPClient,
+        NewClient,
+        // Both constructors return a Route; annotating their results into
+        // the "routes" group lets them coexist.
+        // 两个构造函数都返回Route；将结果注解进"routes"值组使它们得以共存。
+        fx.Annotate(NewHandler, fx.ResultTags(`group:"routes"`)),
+        fx.Annotate(NewEchoBodyHandler, fx.ResultTags(`group:"routes"`)),
+        NewStreamHandler,
+        NewBuildInfo,
+        NewVersionHandler,
+        NewUpstreamHandler,
+        NewHealthHandler,
+        NewReadinessHandler,
+        NewConnStats,
+        NewShutdownHandler,
+        NewMaintenance,
+        NewMaintenanceHandler,
+        NewMaintenanceMiddleware,
+        NewClock,
+        NewRandom,
+        NewMetricsRegistry,
+        NewMetrics,
+        NewMetricsHandler,
+        NewInFlight,
+        NewInFlightHandler,
+        NewInFlightMiddleware,
+        NewConcurrencyLimiter,
+        NewResponseCache,
+        NewAuditLogger,
+        NewConcurrencyLimitMiddleware,
+        NewRequestIDMiddleware,
+        NewAccessLogMiddleware,
+        NewSlowRequestMiddleware,
+        NewCORSMiddleware,
+        NewSecurityHeadersMiddleware,
+        NewMetadataMiddleware,
+        NewRateLimitMiddleware,
+        NewMux,
+    ),
+    // Routes that may fail to build without taking the application down
+    // with them; see OptionalRoute.
+    // 构建失败时不会拖垮整个应用程序的路由；参见OptionalRoute。
+    OptionalRoute("static", NewStaticHandler),
+    OptionalRoute("pprof", NewPprofRoutes),
+    OptionalRoute("echo", NewEchoHandler),
+    OptionalRoute("conns", NewConnStatsHandler),
+    OptionalRoute("breaker", NewCircuitBreakerHandler),
+    OptionalRoute("concurrency", NewConcurrencyHandler),
+    // Since constructors are called lazily, we need some invocations to
+    // kick-start our application. In this case, we'll use Register. Since it
+    // depends on the routes group and *http.ServeMux, calling it requires Fx
+    // to build those types using the constructors above. Since we call
+    // NewMux, we also register Lifecycle hooks to start and stop an HTTP
+    // server. ValidateConfig runs first, so a bad configuration stops the
+    // application before any of that happens, and LogBanner runs last, so
+    // its OnStart hook logs the resolved configuration once the server is
+    // listening.
+    //
+    // Fx runs invocations in exactly the order they're listed, across
+    // fx.Invoke options too, so to add a step in a fixed place, list it in
+    // that place. What the order doesn't pin down is construction:
+    // constructors run when an invocation first needs their result, so
+    // ValidateConfig builds the AppConfig, Register then builds the mux and
+    // everything behind it, and LogBanner reuses what's already built. An
+    // invocation that only needs something built earlier can't change that;
+    // one that depends on a new type moves that type's construction (and its
+    // Lifecycle hooks) to its own position in the list.
+    /*
+    由于构造函数是延迟调用的，因此我们需要一些invocations才能启动我们的应用程序。 在
+    这种情况下，我们将使用Register。 由于它依赖于routes值组和* http.ServeMux，
+    因此调用它需要Fx使用上面的构造函数来构建这些类型。 由于我们称为NewMux，因此我们还
+    注册了Lifecycle挂钩来启动和停止HTTP服务器。LogBanner在其后运行，因此它的OnStart
+    挂钩会在服务器开始监听后记录已解析的配置。ValidateConfig最先运行，因此错误的配置会
+    在这一切发生之前就让应用程序停止。
+
+    Fx严格按照列出的顺序运行invocations（跨多个fx.Invoke选项同样如此），因此要在固定位
+    置加入一个步骤，就把它列在那个位置。顺序无法确定的是构造：构造函数在某个invocation
+    首次需要其结果时才运行，因此ValidateConfig构建AppConfig，随后Register构建mux及其背
+    后的一切，LogBanner则复用已经构建好的内容。只依赖已构建内容的invocation不会改变这一
+    点；依赖新类型的invocation会把该类型的构造（及其Lifecycle挂钩）移到它自己在列表中
+    的位置。
+    */
+    fx.Invoke(ValidateConfig, Register, LogBanner),
+    // Nothing depends on the Scheduler, so this invocation is what builds it
+    // and starts the jobs in the "jobs" group. Listed after Register, its
+    // hooks start once the servers are up and stop before they do.
+    // 没有任何东西依赖Scheduler，因此由这个invocation构建它并启动"jobs"组中的作业。它列在
+    // Register之后，因此它的hooks在服务器启动之后启动，并在服务器停止之前停止。
+    fx.Invoke(func(*Scheduler) {}),
+)
+
+// selfCheck makes a single request to the running server's default route,
+// giving up after a few seconds rather than hanging if the server never came
+// up.
+func selfCheck(logger *LeveledLogger, client *http.Client, cfg AppConfig, tls bool) error {
+    url, client := selfCheckTarget(cfg, tls, client)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return err
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return err
+    }
+    logger.Infof("Self-check: %s %s", resp.Status, bytes.TrimSpace(body))
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("unexpected status %s", resp.Status)
+    }
+    return nil
+}
+
+// selfCheckTarget returns the URL of the default route as the configuration
+// mounts it - the server's address, over HTTPS if tls is set, under
+// MiddlewareConfig.PathPrefix - and the client to request it with. A wildcard
+// or empty host is reached through localhost; a Unix socket through a copy of
+// client that dials the socket whatever the URL says.
+func selfCheckTarget(cfg AppConfig, tls bool, client *http.Client) (string, *http.Client) {
+    scheme := "http"
+    if tls {
+        scheme = "https"
+    }
+    path := cfg.Middleware.PathPrefix + "/"
+    if cfg.Server.network() == NetworkUnix {
+        socket := cfg.Server.addr()
+        unixClient := *client
+        unixClient.Transport = &http.Transport{
+            DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+                var d net.Dialer
+                return d.DialContext(ctx, NetworkUnix, socket)
+            },
+        }
+        return scheme + "://localhost" + path, &unixClient
+    }
+    host, port, err := net.SplitHostPort(cfg.Server.addr())
+    if err != nil {
+        return scheme + "://" + cfg.Server.addr() + path, client
+    }
+    if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+        host = "localhost"
+    }
+    return scheme + "://" + net.JoinHostPort(host, port) + path, client
+}
+
+// alreadyProvidedHint explains the most common wiring mistake newcomers make:
+// Fx allows one constructor per type, so a second constructor for a type
+// that's already provided is an error rather than an override.
+const alreadyProvidedHint = `two constructors provide the same type, but Fx allows only one constructor per type.
+If the application really needs several values of that type, either:
+  - collect them in a value group, as the routes are:
+        fx.Annotate(NewXHandler, fx.ResultTags(` + "`" + `group:"routes"` + "`" + `))
+  - or tell them apart with name tags, as NamedServer does:
+        fx.Annotate(NewX, fx.ResultTags(` + "`" + `name:"x"` + "`" + `))
+If the new constructor should replace the old one, use fx.Decorate or fx.Replace instead`
+
+// newAppWithLogger builds the application around a *log.Logger constructed
+// outside Fx - say, by a larger program embedding this server. fx.Supply adds
+// the logger to the graph as a ready-made value, so there's no constructor to
+// write; NewLogger then wraps it like any other, so levels and the JSON format
+// still apply. Only NewLoggerOutput and NewStdLogger, which would otherwise
+// build a second *log.Logger, are left out.
+//
+// Supply doesn't take precedence over Provide: a supplied value is just a
+// constructor that returns it, so supplying a type something else already
+// provides is the same "already provided" error as two constructors. To
+// override a provided value instead, use fx.Replace or fx.Decorate.
+/*
+    newAppWithLogger 围绕一个在Fx之外构造的*log.Logger（比如由嵌入该服务器的更大程序
+    构造）构建应用程序。fx.Supply将logger作为现成的值加入依赖图，因此无需编写构造函数；
+    随后NewLogger像包装其他logger一样包装它，因此日志级别和JSON格式仍然适用。只有
+    NewLoggerOutput和NewStdLogger被省略，否则它们会再构建一个*log.Logger。
+
+    Supply并不优先于Provide：提供的值只是一个返回它的构造函数，因此Supply一个已被其他
+    构造函数提供的类型，与两个构造函数冲突一样，会导致"already provided"错误。若要覆盖
+    已提供的值，请使用fx.Replace或fx.Decorate。
+*/
+func newAppWithLogger(l *log.Logger, opts ...fx.Option) (*fx.App, error) {
+    module := fx.Module("http",
+        fx.Supply(l),
+        fx.Provide(NewLogger),
+        serverOptions,
+    )
+    return newApp(append([]fx.Option{module}, opts...)...)
+}
+
+// newApp is fx.New, plus validate: it returns the App together with a
+// readable error if the dependency graph couldn't be built.
+func newApp(opts ...fx.Option) (*fx.App, error) {
+    app := fx.New(opts...)
+    return app, validate(app)
+}
+
+// validate reports whether Fx could build the application's dependency
+// graph. fx.New never fails outright: a wiring mistake - a constructor asking
+// for a type nobody provides, or two constructors providing the same one - is
+// stored on the App and only surfaces when Start is called, buried in Fx's
+// own error text. validate checks for it up front and says, in plain terms,
+// what kind of mistake it is and where to look.
+/*
+    validate 检查Fx能否构建应用程序的依赖图。fx.New本身从不失败：连接错误（构造函数
+    请求了无人提供的类型，或者两个构造函数提供了同一类型）会保存在App上，直到调用Start
+    时才会出现，并且埋没在Fx自己的错误文本中。validate会提前检查，并用通俗的语言说明
+    是哪类错误以及应该去哪里查找。
+*/
+func validate(app *fx.App) error {
+    err := app.Err()
+    if err == nil {
+        return nil
+    }
+    var hint string
+    switch msg := err.Error(); {
+    case strings.Contains(msg, "missing type"), strings.Contains(msg, "missing dependencies"):
+        hint = "a constructor or invocation depends on a type that nothing provides. " +
+            "Add its constructor to fx.Provide (see HTTPModule), or mark the parameter `optional:\"true\"`"
+    case strings.Contains(msg, "already provided"):
+        hint = alreadyProvidedHint
+    case strings.Contains(msg, "cycle"):
+        hint = "constructors depend on each other in a cycle. Break it by splitting one of them up"
+    default:
+        return fmt.Errorf("building the application: %w", err)
+    }
+    return fmt.Errorf("building the application: %s.\n\n%w", hint, err)
+}
+
+// bootstrapLog builds a logger for errors that happen outside the graph -
+// loading the configuration, building or starting the application - when
+// the graph's own logger may not exist yet. It's built like the graph's
+// (same format and flags), so those errors look like every other line the
+// application logs, but always writes to standard output: a failure to start
+// belongs on the console even when the application logs to a file.
+/*
+    bootstrapLog 为依赖图之外发生的错误（加载配置、构建或启动应用程序）构建一个logger，
+    这时依赖图自己的logger可能还不存在。它的构建方式与依赖图中的logger相同（相同的格式
+    和标志），因此这些错误看起来与应用程序记录的其他日志一致，但它总是写入标准输出：即使
+    应用程序记录到文件，启动失败也应该显示在控制台上。
+*/
+func bootstrapLog(cfg LoggerConfig) *LeveledLogger {
+    return NewLeveledLogger(NewStdLogger(cfg, LoggerOutput{Writer: os.Stdout}), cfg)
+}
+
+// stopGrace is how long stopApp waits past the stop timeout for app.Stop to
+// return before giving up on it.
+const stopGrace = time.Second
+
+// stopApp stops app, allowing it timeout. Fx stops waiting on hooks once the
+// context expires, but a hook that ignores its context could still keep Stop
+// from returning; stopApp gives up on it stopGrace later, returning the
+// context's error, so the process exits rather than hanging.
+func stopApp(app *fx.App, timeout time.Duration) error {
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+    done := make(chan error, 1)
+    go func() { done <- app.Stop(ctx) }()
+    select {
+    case err := <-done:
+        return err
+    case <-ctx.Done():
+    }
+    select {
+    case err := <-done:
+        return err
+    case <-time.After(stopGrace):
+        return ctx.Err()
+    }
 }
 
 func main() {
-    app := fx.New(
-        // Provide all the constructors we need, which teaches Fx how we'd like to
-        // construct the *log.Logger, http.Handler, and *http.ServeMux types.
-        // Remember that constructors are called lazily, so this block doesn't do
-	// much on its own.
-		/*
-		提供我们需要的所有构造函数，这将教给Fx我们如何构造* log.Logger，http.Handler和
-		* http.ServeMux类型。请记住，构造函数被懒惰地调用，因此，该块本身并不会做太多事情。
-		*/
-        fx.Provide(
-            NewLogger,
-            NewHandler,
-            NewMux,
-        ),
-        // Since constructors are called lazily, we need some invocations to
-        // kick-start our application. In this case, we'll use Register. Since it
-        // depends on an http.Handler and *http.ServeMux, calling it requires Fx
-        // to build those types using the constructors above. Since we call
-        // NewMux, we also register Lifecycle hooks to start and stop an HTTP
-		// server.
-		/*
-		由于构造函数是延迟调用的，因此我们需要一些invocations才能启动我们的应用程序。 在
-		这种情况下，我们将使用Register。 由于它依赖于http.Handler和* http.ServeMux，
-		因此调用它需要Fx使用上面的构造函数来构建这些类型。 由于我们称为NewMux，因此我们还
-		注册了Lifecycle挂钩来启动和停止HTTP服务器。
-		*/
-        fx.Invoke(Register),
+    // fx.Populate pulls the logger out of the graph so main can use it too.
+    // 使用fx.Populate从依赖图中取出logger，以便main也能使用它。
+    var logger *LeveledLogger
+    var order *HookOrder
+    var client *http.Client
+    var tls struct {
+        fx.In
+        TLS TLSConfig `optional:"true"`
+    }
+
+    // main needs the start and stop timeouts before the graph exists, so it
+    // loads the configuration itself and uses fx.Replace to hand that same
+    // AppConfig to the graph instead of having NewConfig read it again.
+    // main在依赖图存在之前就需要启动和停止超时，因此它自己加载配置，并使用fx.Replace将
+    // 同一个AppConfig交给依赖图，而不是让NewConfig再读取一次。
+    //
+    // Until the configuration is loaded, errors are logged in whatever format
+    // the environment asks for; after that, in the configured one.
+    // 在配置加载之前，错误按环境变量要求的格式记录；之后按配置的格式记录。
+    defaults := NewAppConfig()
+    // A bad variable is NewConfig's error to report, just below.
+    // 错误的环境变量由下面的NewConfig报告。
+    applyEnv(&defaults)
+    boot := bootstrapLog(defaults.Log)
+    cfg, err := NewConfig()
+    if err != nil {
+        boot.Errorf("Loading configuration: %v", err)
+        os.Exit(1)
+    }
+    boot = bootstrapLog(cfg.Log)
+    // newApp reports wiring mistakes - a missing constructor, or two for the
+    // same type - in plain terms before we try to start anything.
+    // newApp会在尝试启动任何东西之前，用通俗的语言报告连接错误（缺少构造函数，或者同一
+    // 类型有两个构造函数）。
+    app, err := newApp(
+        HTTPModule,
+        TracingModule,
+        fx.Replace(cfg),
+        fx.StartTimeout(cfg.StartTimeout),
+        fx.StopTimeout(cfg.StopTimeout),
+        fx.Populate(&logger, &order, &client, &tls),
+        // Shut down on SIGINT and SIGTERM, reload on SIGHUP and toggle DEBUG
+        // logging on SIGUSR1. Nothing depends on the SignalHandler, so an
+        // invocation that takes it is what gets it built.
+        // 收到SIGINT和SIGTERM时关闭，收到SIGHUP时重新加载，收到SIGUSR1时切换DEBUG日志。
+        // 没有任何东西依赖SignalHandler，因此由一个接收它的invocation来触发构建。
+        fx.Provide(NewSignalHandler),
+        fx.Invoke(func(*SignalHandler) {}),
     )
+    if err != nil {
+        boot.Error(err)
+        os.Exit(1)
+    }
 
     // In a typical application, we could just use app.Run() here. Since we
-    // don't want this example to run forever, we'll use the more-explicit Start
-	// and Stop.
+    // also want this example to be able to run once and exit (see below),
+    // we'll use the more-explicit Start and Stop.
 	/*
-	在典型的应用程序中，我们可以在此处使用app.Run()。 由于我们不希望该示例永远运行，
-	因此我们将使用更加明确的Start和Stop。
+	在典型的应用程序中，我们可以在此处使用app.Run()。 由于我们也希望该示例能够运行一次
+	后退出（见下文），因此我们将使用更加明确的Start和Stop。
 	*/
-    startCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+    startCtx, cancel := context.WithTimeout(context.Background(), cfg.StartTimeout)
     defer cancel()
     if err := app.Start(startCtx); err != nil {
-        log.Fatal(err)
+        boot.Errorf("Starting: %v", err)
+        os.Exit(1)
     }
 
-    // Normally, we'd block here with <-app.Done(). Instead, we'll make an HTTP
-	// request to demonstrate that our server is running.
+    // Normally, we block here with <-app.Done(). The SignalHandler shuts the
+    // application down on SIGINT and SIGTERM, so Ctrl-C (or an orchestrator
+    // stopping the container) unblocks it and we fall through to Stop, which
+    // runs every OnStop hook.
+    //
+    // Setting INJECT_DEMO instead makes a single HTTP request to demonstrate
+    // that our server is running, then shuts down straight away.
 	/*
-	通常，我们在这里使用<-app.Done（）进行阻止。 相反，我们将发出HTTP请求以证明我们的服务器正在运行。
-	*/
-    http.Get("http://localhost:8080/")
+	通常，我们在这里使用<-app.Done()进行阻止。 SignalHandler在收到SIGINT和SIGTERM时
+	关闭应用程序，因此Ctrl-C（或编排系统停止容器）会解除阻塞，然后执行Stop，运行所有
+	OnStop hooks。
 
-    stopCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-    defer cancel()
-    if err := app.Stop(stopCtx); err != nil {
-        log.Fatal(err)
+	设置INJECT_DEMO后，将改为发出一次HTTP请求以证明我们的服务器正在运行，然后立即关闭。
+	*/
+    var checkErr error
+    if os.Getenv("INJECT_DEMO") != "" {
+        if checkErr = selfCheck(logger, client, cfg, tls.TLS.enabled()); checkErr != nil {
+            logger.Errorf("Self-check failed: %v", checkErr)
+        }
+    } else {
+        <-app.Done()
     }
 
+    // A stop that runs out of time is worth a warning rather than an error:
+    // the hooks that did finish still shut down cleanly, and an orchestrator
+    // would have SIGKILLed us soon anyway. Either way the exit status says
+    // shutdown wasn't clean.
+    // 停止超时值得一个警告而不是错误：已经完成的hooks仍然干净地关闭了，而且编排系统
+    // 很快也会SIGKILL我们。无论哪种情况，退出状态都表明关闭并不干净。
+    if err := stopApp(app, cfg.StopTimeout); err != nil {
+        if errors.Is(err, context.DeadlineExceeded) {
+            logger.Warnf("Stopping: gave up after the %s stop timeout: %v", cfg.StopTimeout, err)
+        } else {
+            logger.Errorf("Stopping: %v", err)
+        }
+        os.Exit(1)
+    }
+    // Fx promises to stop hooks in the reverse of their start order; say so
+    // if it didn't.
+    // Fx保证按启动顺序的相反顺序停止hooks；如果没有做到，就记录下来。
+    if err := order.Check(); err != nil {
+        logger.Warnf("Lifecycle hooks out of order: %v", err)
+    }
+    if checkErr != nil {
+        os.Exit(1)
+    }
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+    "bytes"
+    "io"
+    "log"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "go.uber.org/fx"
+    "go.uber.org/fx/fxtest"
+)
+
+// testApp is the application built by newTestApp: HTTPModule, with the
+// configuration replaced, the log captured and the default server on an
+// ephemeral port.
+type testApp struct {
+    *fxtest.App
+    t     testing.TB
+    order *HookOrder
+    logs  *syncBuffer
+
+    mu      sync.Mutex
+    ln      net.Listener
+    stopped bool
+}
+
+// newTestApp builds, but doesn't start, the application: HTTPModule with the
+// default AppConfig at DEBUG, passed through configure if it's non-nil, plus
+// opts. The *log.Logger is swapped for one writing to a buffer with
+// fx.Decorate, and the servers listen on 127.0.0.1:0 through a ListenFunc.
+func newTestApp(t testing.TB, configure func(*AppConfig), opts ...fx.Option) *testApp {
+    t.Helper()
+    cfg := NewAppConfig()
+    cfg.Log.Level = LevelDebug
+    cfg.Log.Flags = 0
+    if configure != nil {
+        configure(&cfg)
+    }
+    a := &testApp{t: t, logs: new(syncBuffer)}
+    a.App = fxtest.New(t,
+        HTTPModule,
+        fx.Replace(cfg),
+        fx.Decorate(func(*log.Logger) *log.Logger {
+            return log.New(a.logs, "", 0)
+        }),
+        fx.Provide(func() ListenFunc {
+            return func(network, _ string) (net.Listener, error) {
+                ln, err := net.Listen(network, "127.0.0.1:0")
+                if err == nil {
+                    a.mu.Lock()
+                    a.ln = ln
+                    a.mu.Unlock()
+                }
+                return ln, err
+            }
+        }),
+        fx.Populate(&a.order),
+        fx.Options(opts...),
+    )
+    return a
+}
+
+// start starts the application, stopping it again when the test ends unless
+// the test stops it first.
+func (a *testApp) start() *testApp {
+    a.t.Helper()
+    a.RequireStart()
+    a.t.Cleanup(a.stop)
+    return a
+}
+
+// stop stops the application, once.
+func (a *testApp) stop() {
+    a.mu.Lock()
+    stopped := a.stopped
+    a.stopped = true
+    a.mu.Unlock()
+    if !stopped {
+        a.RequireStop()
+    }
+}
+
+// listening reports whether the default server has bound its listener.
+func (a *testApp) listening() bool {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return a.ln != nil
+}
+
+// URL returns the default server's base URL. The application must have
+// started.
+func (a *testApp) URL() string {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    if a.ln == nil {
+        a.t.Fatal("the server isn't listening: was the app started?")
+    }
+    return "http://" + a.ln.Addr().String()
+}
+
+// get makes a GET request for path, not following redirects, and returns
+// the response with its body read.
+func (a *testApp) get(path string) (*http.Response, string) {
+    a.t.Helper()
+    return a.do(http.MethodGet, path, nil)
+}
+
+// do makes a request for path, not following redirects, and returns the
+// response with its body read.
+func (a *testApp) do(method, path string, body io.Reader) (*http.Response, string) {
+    a.t.Helper()
+    req, err := http.NewRequest(method, a.URL()+path, body)
+    if err != nil {
+        a.t.Fatal(err)
+    }
+    client := &http.Client{
+        Timeout: 5 * time.Second,
+        CheckRedirect: func(*http.Request, []*http.Request) error {
+            return http.ErrUseLastResponse
+        },
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        a.t.Fatalf("%s %s: %v", method, path, err)
+    }
+    defer resp.Body.Close()
+    b, err := io.ReadAll(resp.Body)
+    if err != nil {
+        a.t.Fatalf("reading %s %s: %v", method, path, err)
+    }
+    return resp, string(b)
+}
+
+// testRoute provides r in the "routes" group.
+func testRoute(r Route) fx.Option {
+    return fx.Provide(fx.Annotate(func() Route { return r }, fx.ResultTags(`group:"routes"`)))
+}
+
+// syncBuffer is a bytes.Buffer that's safe for the concurrent writes of a
+// logger shared by several goroutines.
+type syncBuffer struct {
+    mu  sync.Mutex
+    buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.buf.String()
+}
+
+// discardLogger returns a LeveledLogger that writes nowhere, for tests of
+// components built without the application.
+func discardLogger() *LeveledLogger {
+    return NewLeveledLogger(log.New(io.Discard, "", 0), NewLoggerConfig())
+}
+
+func TestHandlerLogsRequest(t *testing.T) {
+    app := newTestApp(t, nil).start()
+
+    resp, body := app.get("/")
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("GET / = %s %q, want 200", resp.Status, body)
+    }
+    if !strings.Contains(body, DefaultGreeting) {
+        t.Errorf("GET / = %q, want the greeting %q", body, DefaultGreeting)
+    }
+    if logs := app.logs.String(); !strings.Contains(logs, "Got a request.") {
+        t.Errorf("log doesn't mention the request:\n%s", logs)
+    }
+}
+
+func TestTestAppServesRoutes(t *testing.T) {
+    app := newTestApp(t, nil,
+        testRoute(Route{Path: "/hello", Method: http.MethodGet, Handler: http.HandlerFunc(
+            func(w http.ResponseWriter, _ *http.Request) { io.WriteString(w, "hello") },
+        )}),
+    ).start()
+
+    if resp, body := app.get("/hello"); resp.StatusCode != http.StatusOK || body != "hello" {
+        t.Errorf("GET /hello = %s %q, want 200 \"hello\"", resp.Status, body)
+    }
+    if resp, _ := app.get("/healthz"); resp.StatusCode != http.StatusOK {
+        t.Errorf("GET /healthz = %s, want 200", resp.Status)
+    }
+}
+
+func TestShutdownCancelsRequestContext(t *testing.T) {
+    started := make(chan struct{})
+    cancelled := make(chan struct{})
+    app := newTestApp(t, nil,
+        testRoute(Route{Path: "/block", NoTimeout: true, Handler: http.HandlerFunc(
+            func(w http.ResponseWriter, r *http.Request) {
+                close(started)
+                select {
+                case <-r.Context().Done():
+                    close(cancelled)
+                case <-time.After(5 * time.Second):
+                }
+            },
+        )}),
+    ).start()
+
+    url := app.URL()
+    go func() {
+        if resp, err := http.Get(url + "/block"); err == nil {
+            resp.Body.Close()
+        }
+    }()
+    <-started
+    app.stop()
+
+    select {
+    case <-cancelled:
+    default:
+        t.Fatal("the handler's context wasn't cancelled by shutdown")
+    }
+}
+
+func TestSelfCheckTarget(t *testing.T) {
+    client := &http.Client{}
+    tests := []struct {
+        name   string
+        server ServerConfig
+        prefix string
+        tls    bool
+        want   string
+    }{
+        {"default", ServerConfig{}, "", false, "http://localhost:8080/"},
+        {"host", ServerConfig{Addr: "127.0.0.1:9090"}, "", false, "http://127.0.0.1:9090/"},
+        {"wildcard", ServerConfig{Addr: "[::]:9090"}, "", false, "http://localhost:9090/"},
+        {"prefix and TLS", ServerConfig{Addr: ":8443"}, "/api", true, "https://localhost:8443/api/"},
+    }
+    for _, tt := range tests {
+        cfg := NewAppConfig()
+        cfg.Server, cfg.Middleware.PathPrefix = tt.server, tt.prefix
+        if got, _ := selfCheckTarget(cfg, tt.tls, client); got != tt.want {
+            t.Errorf("%s: selfCheckTarget = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestSelfCheck(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) { c.Middleware.PathPrefix = "/api" }).start()
+
+    cfg := NewAppConfig()
+    cfg.Server.Addr = strings.TrimPrefix(app.URL(), "http://")
+    cfg.Middleware.PathPrefix = "/api"
+    if err := selfCheck(discardLogger(), http.DefaultClient, cfg, false); err != nil {
+        t.Fatalf("selfCheck: %v", err)
+    }
+}
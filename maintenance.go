@@ -0,0 +1,129 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync/atomic"
+)
+
+// AdminPrefix is the path prefix of the admin routes, which stay reachable in
+// maintenance mode so operators can turn it off again.
+const AdminPrefix = "/admin/"
+
+// maintenanceRetryAfter is the Retry-After, in seconds, sent with 503s while
+// in maintenance mode.
+const maintenanceRetryAfter = 120
+
+// Maintenance is the maintenance mode flag. While it's on, every route except
+// the admin routes answers 503, letting operators drain traffic before
+// maintenance without stopping the process. It's an ordinary value in the
+// graph, so any component can check it.
+/*
+    Maintenance 是维护模式标志。开启时，除admin路由外的所有路由都返回503，让运维人员
+    可以在维护前排空流量而无需停止进程。它是依赖图中的普通值，因此任何组件都可以检查它。
+*/
+type Maintenance struct {
+    on     atomic.Bool
+    logger *LeveledLogger
+}
+
+// NewMaintenance constructs the maintenance mode flag, initially off.
+func NewMaintenance(logger *LeveledLogger) *Maintenance {
+    return &Maintenance{logger: logger}
+}
+
+// Enabled reports whether maintenance mode is on.
+func (m *Maintenance) Enabled() bool {
+    return m.on.Load()
+}
+
+// Set turns maintenance mode on or off, logging the change.
+func (m *Maintenance) Set(on bool) {
+    if m.on.Swap(on) == on {
+        return
+    }
+    if on {
+        m.logger.Warn("Maintenance mode enabled: non-admin routes answer 503.")
+    } else {
+        m.logger.Info("Maintenance mode disabled.")
+    }
+}
+
+// NewMaintenanceMiddleware contributes the middleware that answers 503 while
+// maintenance mode is on. The admin routes are exempt wherever they're
+// mounted: under MiddlewareConfig.PathPrefix unless UnprefixedPaths keeps them
+// at the root.
+func NewMaintenanceMiddleware(m *Maintenance, cfg MiddlewareConfig) MiddlewareResult {
+    admin := func(path string) bool {
+        return strings.HasPrefix(path, AdminPrefix) ||
+            cfg.PathPrefix != "" && strings.HasPrefix(path, cfg.PathPrefix+AdminPrefix)
+    }
+    return MiddlewareResult{Middleware: Middleware{
+        Name:     "maintenance",
+        Priority: PriorityMaintenance,
+        Wrap: func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                if m.Enabled() && !admin(r.URL.Path) {
+                    w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+                    WriteProblem(w, http.StatusServiceUnavailable, "", "The server is down for maintenance.")
+                    return
+                }
+                next.ServeHTTP(w, r)
+            })
+        },
+    }}
+}
+
+// NewMaintenanceHandler constructs the /admin/maintenance routes: GET reports
+// whether maintenance mode is on, and POST with ?enabled=true or
+// ?enabled=false turns it on or off. Like /admin/shutdown, they require the
+// admin token, and aren't registered without one.
+/*
+    NewMaintenanceHandler 构造/admin/maintenance路由：GET报告维护模式是否开启，POST
+    带上?enabled=true或?enabled=false来开启或关闭它。与/admin/shutdown一样，它们需要
+    管理令牌，未配置令牌时不会注册。
+*/
+func NewMaintenanceHandler(m *Maintenance, cfg AppConfig) RoutesResult {
+    if cfg.AdminToken == "" {
+        return RoutesResult{}
+    }
+    admin := func(h http.HandlerFunc) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if !validAdminToken(r, cfg.AdminToken) {
+                WriteProblem(w, http.StatusUnauthorized, "", "missing or invalid "+AdminTokenHeader)
+                return
+            }
+            h(w, r)
+        })
+    }
+    status := func(w http.ResponseWriter) {
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(struct {
+            Enabled bool `json:"enabled"`
+        }{m.Enabled()})
+    }
+    return RoutesResult{Routes: []Route{
+        {
+            Path:   AdminPrefix + "maintenance",
+            Method: http.MethodGet,
+            Handler: admin(func(w http.ResponseWriter, _ *http.Request) {
+                status(w)
+            }),
+        },
+        {
+            Path:   AdminPrefix + "maintenance",
+            Method: http.MethodPost,
+            Handler: admin(func(w http.ResponseWriter, r *http.Request) {
+                on, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+                if err != nil {
+                    WriteProblem(w, http.StatusBadRequest, "", "enabled must be true or false")
+                    return
+                }
+                m.Set(on)
+                status(w)
+            }),
+        },
+    }}
+}
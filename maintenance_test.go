@@ -0,0 +1,44 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+)
+
+func TestMaintenanceExemptsPrefixedAdminRoutes(t *testing.T) {
+    const token = "secret"
+    app := newTestApp(t, func(c *AppConfig) {
+        c.AdminToken = token
+        c.Middleware.PathPrefix = "/api"
+    }).start()
+    admin := func(method, path string) *http.Response {
+        t.Helper()
+        req, err := http.NewRequest(method, app.URL()+path, nil)
+        if err != nil {
+            t.Fatal(err)
+        }
+        req.Header.Set(AdminTokenHeader, token)
+        resp, err := http.DefaultClient.Do(req)
+        if err != nil {
+            t.Fatal(err)
+        }
+        resp.Body.Close()
+        return resp
+    }
+
+    if resp := admin(http.MethodPost, "/api/admin/maintenance?enabled=true"); resp.StatusCode != http.StatusOK {
+        t.Fatalf("enabling maintenance mode = %s, want 200", resp.Status)
+    }
+    if resp, _ := app.get("/api/"); resp.StatusCode != http.StatusServiceUnavailable {
+        t.Errorf("GET /api/ in maintenance mode = %s, want 503", resp.Status)
+    }
+    if resp := admin(http.MethodGet, "/api/admin/maintenance"); resp.StatusCode != http.StatusOK {
+        t.Errorf("GET /api/admin/maintenance in maintenance mode = %s, want 200", resp.Status)
+    }
+    if resp := admin(http.MethodPost, "/api/admin/maintenance?enabled=false"); resp.StatusCode != http.StatusOK {
+        t.Fatalf("disabling maintenance mode = %s, want 200", resp.Status)
+    }
+    if resp, _ := app.get("/api/"); resp.StatusCode != http.StatusOK {
+        t.Errorf("GET /api/ after maintenance mode = %s, want 200", resp.Status)
+    }
+}
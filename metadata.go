@@ -0,0 +1,85 @@
+package main
+
+import (
+    "context"
+    "maps"
+    "net/http"
+)
+
+// Well-known keys of MiddlewareConfig.Metadata, read with EnvironmentFrom
+// and RegionFrom.
+const (
+    MetadataEnvironment = "environment"
+    MetadataRegion      = "region"
+)
+
+// metadataKey is the context key the metadata map is stored under. Being an
+// unexported type, it can't collide with another package's keys.
+type metadataKey struct{}
+
+// MetadataFrom returns the value of key in the deployment metadata the
+// metadata middleware stored in ctx, if it's set.
+/*
+    MetadataFrom 返回元数据中间件存储在ctx中的部署元数据里key对应的值（如果已设置）。
+*/
+func MetadataFrom(ctx context.Context, key string) (string, bool) {
+    md, _ := ctx.Value(metadataKey{}).(map[string]string)
+    v, ok := md[key]
+    return v, ok
+}
+
+// Metadata returns a copy of all the deployment metadata stored in ctx, or
+// nil if there is none.
+/*
+    Metadata 返回ctx中存储的全部部署元数据的副本，没有时返回nil。
+*/
+func Metadata(ctx context.Context) map[string]string {
+    md, _ := ctx.Value(metadataKey{}).(map[string]string)
+    return maps.Clone(md)
+}
+
+// EnvironmentFrom returns the MetadataEnvironment entry stored in ctx.
+func EnvironmentFrom(ctx context.Context) (string, bool) {
+    return MetadataFrom(ctx, MetadataEnvironment)
+}
+
+// RegionFrom returns the MetadataRegion entry stored in ctx.
+func RegionFrom(ctx context.Context) (string, bool) {
+    return MetadataFrom(ctx, MetadataRegion)
+}
+
+// WithMetadata returns ctx carrying md as its deployment metadata, for
+// contexts that don't come from a request - a scheduled Job's, say.
+/*
+    WithMetadata 返回携带md作为部署元数据的ctx，用于不来自请求的context，例如计划Job的
+    context。
+*/
+func WithMetadata(ctx context.Context, md map[string]string) context.Context {
+    return context.WithValue(ctx, metadataKey{}, maps.Clone(md))
+}
+
+// NewMetadataMiddleware contributes the middleware that seeds every request's
+// context with MiddlewareConfig.Metadata - the deployment's environment,
+// region and so on - so handlers, and the calls they make downstream, can
+// read it with MetadataFrom and its typed helpers. It runs just inside the
+// security headers, ahead of everything that might log or call out, and is
+// skipped when no metadata is configured.
+/*
+    NewMetadataMiddleware 提供一个中间件，把MiddlewareConfig.Metadata（部署的环境、区域
+    等）放入每个请求的context中，这样handlers及其发起的下游调用可以通过MetadataFrom及其
+    类型化辅助函数读取。它紧挨在安全头中间件内侧，位于所有可能记录日志或向外调用的中间件
+    之前；未配置元数据时不启用。
+*/
+func NewMetadataMiddleware(cfg MiddlewareConfig) MiddlewareResult {
+    m := Middleware{Name: "metadata", Priority: PriorityMetadata}
+    if len(cfg.Metadata) > 0 {
+        // The map is shared by every request, and never written again.
+        md := maps.Clone(cfg.Metadata)
+        m.Wrap = func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), metadataKey{}, md)))
+            })
+        }
+    }
+    return MiddlewareResult{Middleware: m}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewMetricsRegistry constructs the Prometheus registry every metric in the
+// application is registered with. Using our own registry rather than the
+// global default lets tests swap in an isolated one.
+/*
+    NewMetricsRegistry 构造应用程序中所有指标注册到的Prometheus注册表。使用我们自己的
+    注册表而不是全局默认注册表，可以让测试替换为隔离的注册表。
+*/
+func NewMetricsRegistry() *prometheus.Registry {
+    return prometheus.NewRegistry()
+}
+
+// Metrics holds the HTTP server's request metrics.
+/*
+    Metrics 保存HTTP服务器的请求指标。
+*/
+type Metrics struct {
+    requests  *prometheus.CounterVec
+    responses *prometheus.CounterVec
+    latency   *prometheus.HistogramVec
+    clock     Clock
+}
+
+// NewMetrics constructs the request metrics and registers them with reg.
+// Latency is measured with clock.
+func NewMetrics(reg *prometheus.Registry, clock Clock) (*Metrics, error) {
+    m := &Metrics{
+        clock: clock,
+        requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "http_requests_total",
+            Help: "Total number of HTTP requests received.",
+        }, []string{"path", "method"}),
+        responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+            Name: "http_responses_total",
+            Help: "Total number of HTTP responses sent, by status code.",
+        }, []string{"path", "method", "code"}),
+        latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+            Name:    "http_request_duration_seconds",
+            Help:    "HTTP request latency.",
+            Buckets: prometheus.DefBuckets,
+        }, []string{"path", "method"}),
+    }
+    for _, c := range []prometheus.Collector{m.requests, m.responses, m.latency} {
+        if err := reg.Register(c); err != nil {
+            return nil, err
+        }
+    }
+    return m, nil
+}
+
+// instrument records every request to next under the route's path, reading
+// the final status code from a statusRecorder once next returns.
+func (m *Metrics) instrument(path string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := m.clock.Now()
+        rec := newStatusRecorder(w)
+        next.ServeHTTP(rec, r)
+
+        m.requests.WithLabelValues(path, r.Method).Inc()
+        m.responses.WithLabelValues(path, r.Method, strconv.Itoa(rec.Status)).Inc()
+        m.latency.WithLabelValues(path, r.Method).Observe(since(m.clock, start).Seconds())
+    })
+}
+
+// NewMetricsHandler constructs the /metrics route, serving the registry in
+// the Prometheus text format.
+/*
+    NewMetricsHandler 构造/metrics路由，以Prometheus文本格式提供注册表中的指标。
+*/
+func NewMetricsHandler(reg *prometheus.Registry) RouteResult {
+    return RouteResult{Route: Route{
+        Path:    "/metrics",
+        Handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{}),
+    }}
+}
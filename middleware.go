@@ -0,0 +1,476 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "runtime/debug"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "go.opentelemetry.io/otel/trace"
+    "go.uber.org/fx"
+)
+
+// RequestIDHeader carries the request ID on both requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// RequestIDFrom returns the request ID stored in ctx by the request-ID
+// middleware, if any.
+/*
+    RequestIDFrom 返回请求ID中间件存储在ctx中的请求ID（如果有）。
+*/
+func RequestIDFrom(ctx context.Context) (string, bool) {
+    id, ok := ctx.Value(requestIDKey{}).(string)
+    return id, ok
+}
+
+type loggerKey struct{}
+
+// LoggerFrom returns the request-scoped logger the request-ID middleware
+// stored in ctx (see NewContextLogger), if any. Handlers that log through it
+// get lines tagged with the request's IDs, so they can be matched up with
+// the access log.
+/*
+    LoggerFrom 返回请求ID中间件存储在ctx中的请求级logger（参见NewContextLogger）（如果
+    有）。通过它记录日志的handlers会得到带有请求ID标签的日志行，从而可以与访问日志对应。
+*/
+func LoggerFrom(ctx context.Context) (*LeveledLogger, bool) {
+    l, ok := ctx.Value(loggerKey{}).(*LeveledLogger)
+    return l, ok
+}
+
+// NewContextLogger derives r's logger from base, tagged with the request ID
+// and, if r is being traced, the trace ID.
+/*
+    NewContextLogger 从base派生r的logger，带有请求ID标签，如果r正在被追踪，还带有trace ID。
+*/
+func NewContextLogger(base *LeveledLogger, r *http.Request) *LeveledLogger {
+    l := base
+    if id, ok := RequestIDFrom(r.Context()); ok {
+        l = l.With("request_id", id)
+    }
+    if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+        l = l.With("trace_id", sc.TraceID().String())
+    }
+    return l
+}
+
+// requestLogger returns r's logger, falling back to base.
+func requestLogger(r *http.Request, base *LeveledLogger) *LeveledLogger {
+    if l, ok := LoggerFrom(r.Context()); ok {
+        return l
+    }
+    return base
+}
+
+// Middleware wraps every registered route's handler. Middleware is
+// contributed through the "middleware" value group (see MiddlewareResult), so
+// any module can extend the stack without touching Register.
+//
+// By convention, lower Priority wraps further out: the middleware with the
+// lowest Priority sees each request first and each response last. Ties are
+// broken by Name, so the order is always deterministic.
+/*
+    Middleware 包装每个已注册路由的handler。中间件通过"middleware"值组提供（参见
+    MiddlewareResult），因此任何模块都可以扩展中间件栈而无需修改Register。
+
+    按照约定，Priority越低包装得越靠外：Priority最低的中间件最先看到每个请求、最后看到
+    每个响应。相同优先级按Name排序，因此顺序总是确定的。
+*/
+type Middleware struct {
+    Name     string
+    Priority int
+    // Wrap returns next wrapped by the middleware. A nil Wrap is skipped,
+    // which lets optional middleware constructors opt out.
+    Wrap func(next http.Handler) http.Handler
+}
+
+// Priorities of the built-in middleware. Gaps are left so that other
+// middleware can slot in between.
+const (
+    PrioritySecurityHeaders = 50
+    PriorityMetadata        = 60
+    PriorityInFlight        = 100
+    PriorityConcurrency     = 120
+    PriorityTracing         = 150
+    PriorityRequestID       = 200
+    PrioritySlowRequest     = 250
+    PriorityAccessLog       = 300
+    PriorityCORS            = 400
+    PriorityMaintenance     = 450
+    PriorityRateLimit       = 500
+)
+
+// MiddlewareResult adds a Middleware to the "middleware" value group.
+/*
+    MiddlewareResult 将一个Middleware添加到"middleware"值组中。
+*/
+type MiddlewareResult struct {
+    fx.Out
+
+    Middleware Middleware `group:"middleware"`
+}
+
+// sortMiddleware returns the non-nil middleware in mws, outermost first.
+func sortMiddleware(mws []Middleware) []Middleware {
+    var sorted []Middleware
+    for _, m := range mws {
+        if m.Wrap != nil {
+            sorted = append(sorted, m)
+        }
+    }
+    sort.Slice(sorted, func(i, j int) bool {
+        if sorted[i].Priority != sorted[j].Priority {
+            return sorted[i].Priority < sorted[j].Priority
+        }
+        return sorted[i].Name < sorted[j].Name
+    })
+    return sorted
+}
+
+// timeoutMessage is the detail of the 503 sent when a request times out.
+const timeoutMessage = "request timed out"
+
+// WrapHandler applies everything a registered route gets. First come the
+// route-specific layers: a per-request timeout, panic recovery, a request
+// body size limit, response caching for routes flagged Route.Cacheable, HTTP
+// Basic authentication for routes flagged Route.Protected (checked before the
+// cache, so cached responses stay protected), the audit log for routes
+// flagged Route.Audit (outside authentication, so rejected attempts are
+// audited too), the route's own concurrency cap (Route.MaxConcurrent), and
+// request metrics keyed by the route's path.
+// The timeout and recovery can be turned off in MiddlewareConfig, and the
+// timeout for individual routes with Route.NoTimeout. The timeout and body
+// limit are read from the LiveConfig on every request, so a reload changes
+// them in place. Then the "middleware" group is applied around them, in
+// Priority order.
+/*
+    WrapHandler 应用已注册路由获得的所有内容。首先是特定于路由的各层：每个请求的超时、
+    panic恢复、请求体大小限制、对标记为Route.Cacheable的路由的响应缓存、对标记为
+    Route.Protected的路由的HTTP Basic认证（在缓存之前检查，因此缓存的响应仍受保护）、
+    对标记为Route.Audit的路由的审计日志（在认证之外，因此被拒绝的尝试也会被审计）、
+    路由自己的并发上限（Route.MaxConcurrent），以及以路由路径为键的请求指标。超时和恢复
+    可以在MiddlewareConfig中关闭，单个路由的超时可以通过Route.NoTimeout关闭。超时和请求
+    体限制在每个请求时从LiveConfig读取，因此重新加载配置会就地改变它们。然后按Priority
+    顺序在其外层应用"middleware"组。
+*/
+func (p RegisterParams) WrapHandler(r Route) http.Handler {
+    return applyMiddleware(p.routeHandler(r), sortMiddleware(p.Middleware))
+}
+
+// applyMiddleware wraps h with mws, which must already be sorted.
+func applyMiddleware(h http.Handler, mws []Middleware) http.Handler {
+    for i := len(mws) - 1; i >= 0; i-- {
+        h = mws[i].Wrap(h)
+    }
+    return h
+}
+
+// routeHandler applies the route-specific layers described on WrapHandler.
+func (p RegisterParams) routeHandler(r Route) http.Handler {
+    h := guardWrites(r.Handler)
+    if !r.NoTimeout {
+        h = p.withTimeout(h)
+    }
+    if !p.Config.DisableRecovery {
+        h = recoverPanics(h, p.Logger, r)
+    }
+    h = p.withBodyLimit(h, r)
+    if r.Cacheable && p.Cache != nil {
+        h = p.Cache.route(r, h)
+    }
+    if r.Protected {
+        h = basicAuth(h, p.Config.BasicAuth)
+    }
+    if r.Audit && p.Audit != nil {
+        h = p.Audit.route(r, h)
+    }
+    if r.MaxConcurrent > 0 && p.Concurrency != nil {
+        h = p.Concurrency.route(r.describe(), r.MaxConcurrent, h)
+    }
+    return p.Metrics.instrument(r.Path, h)
+}
+
+// middlewareConfig returns the MiddlewareConfig currently in effect: the
+// LiveConfig's, if there is one.
+func (p RegisterParams) middlewareConfig() MiddlewareConfig {
+    if p.Live != nil {
+        return p.Live.Load().Middleware
+    }
+    return p.Config
+}
+
+// withTimeout applies the live MiddlewareConfig.RequestTimeout to each
+// request, if it's set. Upgrade requests (WebSockets, say) are let through
+// untimed: http.TimeoutHandler's writer can't be hijacked, and the
+// connection outlives the request anyway.
+func (p RegisterParams) withTimeout(h http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if timeout := p.middlewareConfig().RequestTimeout; timeout > 0 && !isUpgrade(r) {
+            id, _ := RequestIDFrom(r.Context())
+            body := problemBody(newProblem(http.StatusServiceUnavailable, "", timeoutMessage, id))
+            http.TimeoutHandler(h, timeout, body).ServeHTTP(timeoutProblemWriter{w}, r)
+            return
+        }
+        h.ServeHTTP(w, r)
+    })
+}
+
+// isUpgrade reports whether r asks to switch protocols: a Connection header
+// listing "upgrade", with the protocol in Upgrade.
+func isUpgrade(r *http.Request) bool {
+    if r.Header.Get("Upgrade") == "" {
+        return false
+    }
+    for _, v := range r.Header.Values("Connection") {
+        for _, token := range strings.Split(v, ",") {
+            if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// timeoutProblemWriter labels http.TimeoutHandler's 503 as problem details.
+// TimeoutHandler writes its body without setting a Content-Type, whereas a
+// response it relays from the handler carries the handler's headers; so a
+// 503 with no Content-Type is the timeout's own.
+type timeoutProblemWriter struct {
+    http.ResponseWriter
+}
+
+func (w timeoutProblemWriter) WriteHeader(code int) {
+    if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+        w.Header().Set("Content-Type", ProblemContentType)
+        w.Header().Set("X-Content-Type-Options", "nosniff")
+    }
+    w.ResponseWriter.WriteHeader(code)
+}
+
+// withBodyLimit applies route's body size limit, falling back to the live
+// MiddlewareConfig.MaxBodyBytes.
+func (p RegisterParams) withBodyLimit(h http.Handler, route Route) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if limit := route.maxBodyBytes(p.middlewareConfig().MaxBodyBytes); limit > 0 {
+            limitBody(h, limit).ServeHTTP(w, r)
+            return
+        }
+        h.ServeHTTP(w, r)
+    })
+}
+
+// NewRequestIDMiddleware contributes the request-ID middleware, which draws
+// new IDs from random.
+func NewRequestIDMiddleware(logger *LeveledLogger, random Random) MiddlewareResult {
+    return MiddlewareResult{Middleware: Middleware{
+        Name:     "request-id",
+        Priority: PriorityRequestID,
+        Wrap:     func(next http.Handler) http.Handler { return requestID(next, logger, random) },
+    }}
+}
+
+// NewAccessLogMiddleware contributes the access-log middleware, unless
+// MiddlewareConfig.AccessLog is AccessLogOff. Timestamps and durations come
+// from clock.
+func NewAccessLogMiddleware(cfg MiddlewareConfig, logger *LeveledLogger, clock Clock) MiddlewareResult {
+    m := Middleware{Name: "access-log", Priority: PriorityAccessLog}
+    if cfg.AccessLog != AccessLogOff {
+        combined := cfg.AccessLog == AccessLogCombined
+        m.Wrap = func(next http.Handler) http.Handler { return accessLog(next, logger, clock, combined) }
+    }
+    return MiddlewareResult{Middleware: m}
+}
+
+// NewSlowRequestMiddleware contributes the middleware that logs a WARN line
+// for every request taking longer than MiddlewareConfig.SlowRequestThreshold,
+// unless the threshold is zero. The latency histogram shows that the tail is
+// slow; this shows which requests are in it. It runs inside the request-ID
+// middleware, so each line carries the request's ID.
+/*
+    NewSlowRequestMiddleware 提供一个中间件，对耗时超过
+    MiddlewareConfig.SlowRequestThreshold的每个请求记录一行WARN日志（阈值为零时不启用）。
+    延迟直方图显示尾部很慢；这一中间件显示哪些请求位于尾部。它运行在请求ID中间件内侧，
+    因此每一行都带有请求的ID。
+*/
+func NewSlowRequestMiddleware(cfg MiddlewareConfig, logger *LeveledLogger, clock Clock) MiddlewareResult {
+    m := Middleware{Name: "slow-request", Priority: PrioritySlowRequest}
+    if threshold := cfg.SlowRequestThreshold; threshold > 0 {
+        m.Wrap = func(next http.Handler) http.Handler { return slowRequests(next, logger, clock, threshold) }
+    }
+    return MiddlewareResult{Middleware: m}
+}
+
+// NewCORSMiddleware contributes the CORS middleware, if any origins are
+// configured.
+func NewCORSMiddleware(cfg MiddlewareConfig) MiddlewareResult {
+    m := Middleware{Name: "cors", Priority: PriorityCORS}
+    if cfg.CORS.enabled() {
+        m.Wrap = func(next http.Handler) http.Handler { return cors(next, cfg.CORS) }
+    }
+    return MiddlewareResult{Middleware: m}
+}
+
+// recoverPanics turns a panic in next, the handler for route, into a 500
+// problem details response instead of letting it take down the serving goroutine. The log
+// line names the route that panicked, as registered, alongside the request
+// itself, the request ID (if any), the type and value of the panic and its
+// stack trace. If next had already started its response, the status is out
+// and a problem body would only be appended to whatever it wrote, so the
+// panic is just logged.
+func recoverPanics(next http.Handler, logger *LeveledLogger, route Route) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        rec := newStatusRecorder(w)
+        defer func() {
+            v := recover()
+            if v == nil {
+                return
+            }
+            if v == http.ErrAbortHandler {
+                // The conventional way to abort a response; let net/http handle it.
+                panic(v)
+            }
+            requestLogger(r, logger).Errorf("Route %s panicked serving %s %s: %T: %v\n%s",
+                route.describe(), r.Method, r.URL.Path, v, v, debug.Stack())
+            if !rec.wroteHeader {
+                WriteProblem(rec, http.StatusInternalServerError, "", "")
+            }
+        }()
+        next.ServeHTTP(rec, r)
+    })
+}
+
+// guardWrites hands next a statusRecorder, so a WriteHeader after next's
+// response has started is dropped right where next makes it, before it can
+// reach http.TimeoutHandler's writer or net/http's, which would log a
+// "superfluous WriteHeader call" for it.
+func guardWrites(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        next.ServeHTTP(newStatusRecorder(w), r)
+    })
+}
+
+// requestID tags each request with an ID, reusing the caller's X-Request-ID
+// when present and generating a UUID from random otherwise. The ID is stored
+// in the request context and echoed in the response header, and the request's
+// logger (see NewContextLogger) is stored alongside it.
+func requestID(next http.Handler, logger *LeveledLogger, random Random) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get(RequestIDHeader)
+        if id == "" {
+            id = newUUID(random)
+        }
+        w.Header().Set(RequestIDHeader, id)
+        r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+        rl := NewContextLogger(logger, r)
+        rl.Debugf("Request: %s %s", r.Method, r.URL.Path)
+        next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), loggerKey{}, rl)))
+    })
+}
+
+// newUUID returns a random (version 4) UUID drawn from random.
+func newUUID(random Random) string {
+    var b [16]byte
+    if _, err := io.ReadFull(random, b[:]); err != nil {
+        // Neither math/rand nor crypto/rand fails on supported platforms.
+        panic(err)
+    }
+    b[6] = b[6]&0x0f | 0x40
+    b[8] = b[8]&0x3f | 0x80
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// clfTimeFormat is the timestamp layout of the Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLog logs each request to next in the Common Log Format, followed by
+// how long it took. combined selects the Combined Log Format, which also
+// records the referer and user agent. With the slog backend, the same fields
+// are logged as structured attributes instead.
+func accessLog(next http.Handler, logger *LeveledLogger, clock Clock, combined bool) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := clock.Now()
+        rec := newStatusRecorder(w)
+        next.ServeHTTP(rec, r)
+        elapsed := since(clock, start)
+
+        logger := requestLogger(r, logger)
+        host := clientIP(r)
+        if sl := logger.Slog(); sl != nil {
+            attrs := []slog.Attr{
+                slog.String("remote", host),
+                slog.String("method", r.Method),
+                slog.String("path", r.URL.RequestURI()),
+                slog.String("proto", r.Proto),
+                slog.Int("status", rec.Status),
+                slog.Int("bytes", rec.Bytes),
+                slog.Duration("duration", elapsed),
+            }
+            if combined {
+                attrs = append(attrs, slog.String("referer", r.Referer()), slog.String("user_agent", r.UserAgent()))
+            }
+            sl.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+            return
+        }
+        size := "-"
+        if rec.Bytes > 0 {
+            size = strconv.Itoa(rec.Bytes)
+        }
+        line := fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %s",
+            host, start.Format(clfTimeFormat), r.Method, r.URL.RequestURI(), r.Proto, rec.Status, size)
+        if combined {
+            line += fmt.Sprintf(" %q %q", r.Referer(), r.UserAgent())
+        }
+        logger.Infof("%s %s", line, elapsed)
+    })
+}
+
+// slowRequests logs each request to next that takes longer than threshold,
+// with the final status read from a statusRecorder once next returns.
+func slowRequests(next http.Handler, logger *LeveledLogger, clock Clock, threshold time.Duration) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := clock.Now()
+        rec := newStatusRecorder(w)
+        next.ServeHTTP(rec, r)
+        elapsed := since(clock, start)
+        if elapsed <= threshold {
+            return
+        }
+        logger := requestLogger(r, logger)
+        if sl := logger.Slog(); sl != nil {
+            sl.LogAttrs(r.Context(), slog.LevelWarn, "slow request",
+                slog.String("method", r.Method),
+                slog.String("path", r.URL.Path),
+                slog.Int("status", rec.Status),
+                slog.Duration("duration", elapsed),
+                slog.Duration("threshold", threshold),
+            )
+            return
+        }
+        logger.Warnf("Slow request %s %s: %d after %s (threshold %s).",
+            r.Method, r.URL.Path, rec.Status, elapsed, threshold)
+    })
+}
+
+// limitBody caps request bodies at limit bytes. A declared Content-Length over
+// the limit is refused with 413 before next runs at all; otherwise the body
+// is wrapped with http.MaxBytesReader, so next gets an error if it reads past
+// the limit.
+func limitBody(next http.Handler, limit int64) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.ContentLength > limit {
+            WriteProblem(w, http.StatusRequestEntityTooLarge, "",
+                "request body exceeds "+strconv.FormatInt(limit, 10)+" bytes")
+            return
+        }
+        r.Body = http.MaxBytesReader(w, r.Body, limit)
+        next.ServeHTTP(w, r)
+    })
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+    "errors"
+    "io"
+    "log"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestBodyLimitRejectsBeforeHandlerReads(t *testing.T) {
+    p := RegisterParams{Config: MiddlewareConfig{MaxBodyBytes: 16}}
+    var called bool
+    h := p.withBodyLimit(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+        called = true
+    }), Route{Path: "/upload"})
+
+    req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", 17)))
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+
+    if rec.Code != http.StatusRequestEntityTooLarge {
+        t.Errorf("oversized body = %d, want 413", rec.Code)
+    }
+    if called {
+        t.Error("the handler was called with an oversized body")
+    }
+}
+
+func TestBodyLimitCapsUndeclaredLength(t *testing.T) {
+    p := RegisterParams{Config: MiddlewareConfig{MaxBodyBytes: 16}}
+    var readErr error
+    h := p.withBodyLimit(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+        _, readErr = io.ReadAll(r.Body)
+    }), Route{Path: "/upload"})
+
+    req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", 17)))
+    req.ContentLength = -1
+    h.ServeHTTP(httptest.NewRecorder(), req)
+
+    var tooLarge *http.MaxBytesError
+    if !errors.As(readErr, &tooLarge) {
+        t.Errorf("reading an oversized chunked body: %v, want a *http.MaxBytesError", readErr)
+    }
+}
+
+func TestBodyLimitRouteOverride(t *testing.T) {
+    p := RegisterParams{Config: MiddlewareConfig{MaxBodyBytes: 16}}
+    var called bool
+    h := p.withBodyLimit(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+        called = true
+    }), Route{Path: "/upload", MaxBodyBytes: 64})
+
+    req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("x", 32)))
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+
+    if !called || rec.Code != http.StatusOK {
+        t.Errorf("body within the route's own limit: handler called %t, status %d; want it called and 200", called, rec.Code)
+    }
+}
+
+// serveWithErrorLog serves h on an httptest server whose ErrorLog - where
+// net/http reports superfluous WriteHeader calls - writes to the returned
+// buffer.
+func serveWithErrorLog(t *testing.T, h http.Handler) (*httptest.Server, *syncBuffer) {
+    t.Helper()
+    errs := new(syncBuffer)
+    srv := httptest.NewUnstartedServer(h)
+    srv.Config.ErrorLog = log.New(errs, "", 0)
+    srv.Start()
+    t.Cleanup(srv.Close)
+    return srv, errs
+}
+
+func TestSlowHandlerWritesAfterTimeout(t *testing.T) {
+    p := RegisterParams{Config: MiddlewareConfig{RequestTimeout: 20 * time.Millisecond}}
+    answered := make(chan struct{})
+    lateWrite := make(chan error, 1)
+    h := p.withTimeout(guardWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        // The context ends a moment before TimeoutHandler gives up on the
+        // handler, so wait for the client to have the 503.
+        <-answered
+        w.WriteHeader(http.StatusOK)
+        _, err := io.WriteString(w, "too late")
+        lateWrite <- err
+    })))
+    srv, errs := serveWithErrorLog(t, h)
+
+    resp, err := http.Get(srv.URL)
+    close(answered)
+    if err != nil {
+        t.Fatal(err)
+    }
+    body, _ := io.ReadAll(resp.Body)
+    resp.Body.Close()
+
+    if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), timeoutMessage) {
+        t.Errorf("timed-out request = %s %q, want 503 mentioning %q", resp.Status, body, timeoutMessage)
+    }
+    if strings.Contains(string(body), "too late") {
+        t.Errorf("the late write reached the response: %q", body)
+    }
+    select {
+    case err := <-lateWrite:
+        if !errors.Is(err, http.ErrHandlerTimeout) {
+            t.Errorf("late write returned %v, want http.ErrHandlerTimeout", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("the handler never returned")
+    }
+    if logged := errs.String(); logged != "" {
+        t.Errorf("net/http logged errors:\n%s", logged)
+    }
+}
+
+func TestRepeatedWriteHeaderIsDropped(t *testing.T) {
+    p := RegisterParams{}
+    h := p.withTimeout(guardWrites(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        w.WriteHeader(http.StatusAccepted)
+        w.WriteHeader(http.StatusInternalServerError)
+        io.WriteString(w, "ok")
+    })))
+    srv, errs := serveWithErrorLog(t, h)
+
+    resp, err := http.Get(srv.URL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+
+    if resp.StatusCode != http.StatusAccepted {
+        t.Errorf("status = %s, want the first WriteHeader's 202", resp.Status)
+    }
+    if strings.Contains(errs.String(), "superfluous") {
+        t.Errorf("net/http logged a superfluous WriteHeader:\n%s", errs)
+    }
+}
+
+func TestRecoverAfterPartialResponse(t *testing.T) {
+    h := recoverPanics(guardWrites(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        io.WriteString(w, "partial")
+        panic("halfway through")
+    })), discardLogger(), Route{Path: "/"})
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+    if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+        t.Errorf("panic after a partial response = %d %q, want the partial 200 left alone", rec.Code, rec.Body)
+    }
+}
+
+func TestRecoverBeforeResponse(t *testing.T) {
+    h := recoverPanics(guardWrites(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+        panic("before anything was written")
+    })), discardLogger(), Route{Path: "/"})
+
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+    if rec.Code != http.StatusInternalServerError || rec.Header().Get("Content-Type") != ProblemContentType {
+        t.Errorf("panic before the response = %d %q, want a 500 problem", rec.Code, rec.Header().Get("Content-Type"))
+    }
+}
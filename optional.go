@@ -0,0 +1,110 @@
+package main
+
+import (
+    "fmt"
+    "reflect"
+    "slices"
+    "sort"
+
+    "go.uber.org/fx"
+)
+
+// RouteAttempt is the outcome of building an optional route: its Routes, or
+// the error its constructor returned instead.
+/*
+    RouteAttempt 是构建一个可选路由的结果：它的Routes，或者其构造函数返回的错误。
+*/
+type RouteAttempt struct {
+    Name   string
+    Routes []Route
+    Err    error
+}
+
+var (
+    routeType        = reflect.TypeOf(Route{})
+    routesType       = reflect.TypeOf([]Route(nil))
+    errorType        = reflect.TypeOf((*error)(nil)).Elem()
+    routeAttemptType = reflect.TypeOf(RouteAttempt{})
+)
+
+// OptionalRoute provides the route built by constructor, a function returning
+// (Route, error) - or ([]Route, error), for a set of routes that stand or
+// fall together - without letting its error abort the application as Fx
+// otherwise would. The outcome goes to the "route_attempts" group instead,
+// where Register picks it up: a route that failed to build is logged and
+// left out, unless name is listed in MiddlewareConfig.RequiredRoutes, in
+// which case the error fails startup after all. A zero Route (one with no
+// Handler) stands for no route, for constructors that are turned off by
+// configuration.
+//
+// constructor's parameters are injected like any constructor's; OptionalRoute
+// only changes what happens to its results.
+/*
+    OptionalRoute 提供由constructor（一个返回(Route, error)的函数，或者对于共同成败的一组
+    路由，返回([]Route, error)的函数）构建的路由，但不会像Fx通常那样让它的错误中止应用程序。结果改为进入"route_attempts"值组，由Register
+    收集：构建失败的路由会被记录并略过，除非name列在MiddlewareConfig.RequiredRoutes中，
+    这种情况下该错误仍会使启动失败。零值Route（没有Handler）表示没有路由，供通过配置
+    关闭的构造函数使用。
+
+    constructor的参数与其他构造函数一样通过依赖注入提供；OptionalRoute只改变其结果的
+    处理方式。
+*/
+func OptionalRoute(name string, constructor interface{}) fx.Option {
+    fn := reflect.ValueOf(constructor)
+    t := fn.Type()
+    if t.Kind() != reflect.Func || t.NumOut() != 2 || (t.Out(0) != routeType && t.Out(0) != routesType) || t.Out(1) != errorType {
+        return fx.Error(fmt.Errorf("optional route %s: constructor must be a func returning (Route, error) or ([]Route, error), got %v", name, t))
+    }
+    in := make([]reflect.Type, t.NumIn())
+    for i := range in {
+        in[i] = t.In(i)
+    }
+    wrapped := reflect.MakeFunc(reflect.FuncOf(in, []reflect.Type{routeAttemptType}, t.IsVariadic()),
+        func(args []reflect.Value) []reflect.Value {
+            var out []reflect.Value
+            if t.IsVariadic() {
+                out = fn.CallSlice(args)
+            } else {
+                out = fn.Call(args)
+            }
+            attempt := RouteAttempt{Name: name}
+            switch routes := out[0].Interface().(type) {
+            case Route:
+                attempt.Routes = []Route{routes}
+            case []Route:
+                attempt.Routes = routes
+            }
+            attempt.Err, _ = out[1].Interface().(error)
+            return []reflect.Value{reflect.ValueOf(attempt)}
+        })
+    return fx.Provide(fx.Annotate(wrapped.Interface(), fx.ResultTags(`group:"route_attempts"`)))
+}
+
+// collectRoutes returns the routes to register: the "routes" group, plus the
+// optional routes that built. It fails on a required route that didn't
+// build, or that nothing provides.
+func (p RegisterParams) collectRoutes() ([]Route, error) {
+    routes := append([]Route(nil), p.Routes...)
+    attempts := append([]RouteAttempt(nil), p.Attempts...)
+    sort.Slice(attempts, func(i, j int) bool { return attempts[i].Name < attempts[j].Name })
+    for _, a := range attempts {
+        if a.Err != nil {
+            if slices.Contains(p.Config.RequiredRoutes, a.Name) {
+                return nil, fmt.Errorf("required route %s: %w", a.Name, a.Err)
+            }
+            p.Logger.Warnf("Skipping optional route %s: %v", a.Name, a.Err)
+            continue
+        }
+        for _, r := range a.Routes {
+            if r.Handler != nil {
+                routes = append(routes, r)
+            }
+        }
+    }
+    for _, name := range p.Config.RequiredRoutes {
+        if !slices.ContainsFunc(attempts, func(a RouteAttempt) bool { return a.Name == name }) {
+            return nil, fmt.Errorf("required route %s: no OptionalRoute provides it", name)
+        }
+    }
+    return routes, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+
+    "go.uber.org/fx"
+)
+
+func TestPprofRoutes(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) { c.EnablePprof = true }).start()
+
+    if resp, body := app.get("/debug/pprof/"); resp.StatusCode != http.StatusOK || !strings.Contains(body, "goroutine") {
+        t.Errorf("GET /debug/pprof/ = %s, want the profile index", resp.Status)
+    }
+    if resp, body := app.get("/debug/echo?x=1"); resp.StatusCode != http.StatusOK || !strings.Contains(body, `"path":"/debug/echo"`) {
+        t.Errorf("GET /debug/echo = %s %q, want the request described", resp.Status, body)
+    }
+}
+
+func TestDebugRoutesSkippedOnUnknownDebugServer(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) {
+        c.EnablePprof = true
+        c.DebugServer = "admin"
+    }).start()
+
+    if _, body := app.get("/debug/pprof/"); strings.Contains(body, "goroutine") {
+        t.Error("GET /debug/pprof/ served the profile index, want the route skipped")
+    }
+    for _, name := range []string{"pprof", "echo", "conns", "concurrency"} {
+        if logs := app.logs.String(); !strings.Contains(logs, "Skipping optional route "+name+`: debug_server: no server named "admin"`) {
+            t.Errorf("log doesn't mention skipping %s:\n%s", name, logs)
+        }
+    }
+}
+
+func TestRequiredPprofStopsStartup(t *testing.T) {
+    cfg := NewAppConfig()
+    cfg.EnablePprof = true
+    cfg.DebugServer = "admin"
+    cfg.Middleware.RequiredRoutes = []string{"pprof"}
+    app := fx.New(HTTPModule, fx.Replace(cfg), fx.NopLogger)
+
+    if err := app.Err(); err == nil || !strings.Contains(err.Error(), "required route pprof") {
+        t.Errorf("fx.New = %v, want the required pprof route's error", err)
+    }
+}
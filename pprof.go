@@ -0,0 +1,82 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/pprof"
+    "slices"
+
+    "go.uber.org/fx"
+)
+
+// DebugParams are what the debug routes - pprof, /debug/echo, /debug/conns,
+// /debug/breaker and /debug/concurrency - have in common: the configuration,
+// and the servers added with NamedServer, one of which AppConfig.DebugServer
+// may name.
+type DebugParams struct {
+    fx.In
+
+    Config AppConfig
+    Muxes  []NamedMux `group:"muxes"`
+}
+
+// mount puts routes on AppConfig.DebugServer, failing if no server has that
+// name. The debug routes are provided through OptionalRoute, so that failure
+// leaves them out instead of stopping the application.
+func (p DebugParams) mount(routes ...Route) ([]Route, error) {
+    name := p.Config.DebugServer
+    if name != "" && !slices.ContainsFunc(p.Muxes, func(m NamedMux) bool { return m.Name == name }) {
+        return nil, fmt.Errorf("debug_server: no server named %q", name)
+    }
+    for i := range routes {
+        routes[i].Server = name
+    }
+    return routes, nil
+}
+
+// NewPprofRoutes constructs the net/http/pprof routes under /debug/pprof/
+// when AppConfig.EnablePprof is set, and no routes otherwise, so profiling
+// endpoints aren't exposed in production by default.
+//
+// The routes are mounted on the server named by AppConfig.DebugServer (for
+// example an admin server added with NamedServer), or on the main server when
+// that's empty. Profiles and traces run for as long as the caller asks, so the
+// routes are exempt from the request timeout.
+//
+// It's provided through OptionalRoute as "pprof", like the other debug routes
+// under their own names: a DebugServer naming no server is an error that
+// skips them rather than stopping the application, unless
+// MiddlewareConfig.RequiredRoutes lists them.
+/*
+    NewPprofRoutes 在设置了AppConfig.EnablePprof时构造/debug/pprof/下的net/http/pprof
+    路由，否则不返回任何路由，因此默认情况下生产环境不会暴露性能分析端点。
+
+    路由挂载在AppConfig.DebugServer指定的服务器上（例如通过NamedServer添加的admin
+    服务器），为空时挂载在主服务器上。profile和trace会按调用者要求的时长运行，因此这些
+    路由不受请求超时的限制。
+
+    它通过OptionalRoute以"pprof"之名提供，其他调试路由也以各自的名字提供：DebugServer
+    指定了不存在的服务器时返回错误，这只会略过这些路由而不会使应用程序停止，除非
+    MiddlewareConfig.RequiredRoutes列出了它们。
+*/
+func NewPprofRoutes(p DebugParams) ([]Route, error) {
+    if !p.Config.EnablePprof {
+        return nil, nil
+    }
+    handlers := map[string]http.HandlerFunc{
+        "/debug/pprof/":        pprof.Index,
+        "/debug/pprof/cmdline": pprof.Cmdline,
+        "/debug/pprof/profile": pprof.Profile,
+        "/debug/pprof/symbol":  pprof.Symbol,
+        "/debug/pprof/trace":   pprof.Trace,
+    }
+    var routes []Route
+    for path, h := range handlers {
+        routes = append(routes, Route{
+            Path:      path,
+            Handler:   h,
+            NoTimeout: true,
+        })
+    }
+    return p.mount(routes...)
+}
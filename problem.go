@@ -0,0 +1,64 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details object. RequestID is an extension
+// member carrying the request's X-Request-ID, so a client reporting an error
+// can quote the ID that finds it in the logs.
+/*
+    Problem 是RFC 7807的problem details对象。RequestID是一个扩展成员，携带请求的
+    X-Request-ID，这样报告错误的客户端可以引用该ID在日志中找到对应记录。
+*/
+type Problem struct {
+    Type      string `json:"type,omitempty"`
+    Title     string `json:"title"`
+    Status    int    `json:"status"`
+    Detail    string `json:"detail,omitempty"`
+    RequestID string `json:"request_id,omitempty"`
+}
+
+// newProblem builds the Problem for status, titled with the status text
+// unless title is given.
+func newProblem(status int, title, detail, requestID string) Problem {
+    if title == "" {
+        title = http.StatusText(status)
+    }
+    return Problem{Title: title, Status: status, Detail: detail, RequestID: requestID}
+}
+
+// WriteProblem replies with an application/problem+json body describing the
+// error, in place of http.Error. An empty title defaults to the status text.
+// The request ID is taken from the response's X-Request-ID header, which the
+// request-ID middleware sets before passing the request on; errors written by
+// middleware further out than it go without one.
+/*
+    WriteProblem 以描述错误的application/problem+json响应体作答，用于替代http.Error。
+    title为空时默认使用状态文本。请求ID取自响应的X-Request-ID头，该头由请求ID中间件在
+    继续传递请求之前设置；比它更靠外的中间件写出的错误不带请求ID。
+*/
+func WriteProblem(w http.ResponseWriter, status int, title, detail string) {
+    h := w.Header()
+    // Like http.Error, drop headers meant for the response we're replacing.
+    h.Del("Content-Length")
+    h.Set("Content-Type", ProblemContentType)
+    h.Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(newProblem(status, title, detail, h.Get(RequestIDHeader)))
+}
+
+// problemBody returns the JSON encoding of a Problem, for APIs such as
+// http.TimeoutHandler that take a ready-made body.
+func problemBody(p Problem) string {
+    b, err := json.Marshal(p)
+    if err != nil {
+        // A Problem is all strings and an int; this can't happen.
+        return p.Title
+    }
+    return string(b)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+    crand "crypto/rand"
+    "io"
+    "math/rand"
+    "sync"
+    "time"
+)
+
+// Random is the application's source of random bytes. Code that needs
+// randomness - request IDs, for a start - takes a Random rather than reaching
+// for math/rand or crypto/rand itself, so tests can make it deterministic.
+//
+// HTTPModule provides NewRandom, a seedable pseudo-random source: set
+// AppConfig.RandomSeed (or have a test supply its own AppConfig) and every run
+// produces the same sequence. That's fine for correlation IDs, but it's
+// predictable. Deployments that need IDs nobody can guess - tokens, anything
+// security-sensitive - should switch to the crypto-backed variant:
+//
+//   fx.Decorate(func(Random) Random { return NewCryptoRandom() })
+/*
+    Random 是应用程序的随机字节来源。需要随机性的代码（首先是请求ID）接收一个Random，
+    而不是自己使用math/rand或crypto/rand，这样测试就可以让它变得确定。
+
+    HTTPModule提供NewRandom，一个可设置种子的伪随机源：设置AppConfig.RandomSeed（或让
+    测试提供自己的AppConfig），每次运行都会产生相同的序列。这对关联ID来说没有问题，但
+    它是可预测的。需要无法被猜测的ID（令牌或任何安全敏感的内容）的部署应切换到基于crypto
+    的版本（示例见上）。
+*/
+type Random interface {
+    io.Reader
+}
+
+// NewRandom constructs a pseudo-random Random seeded with cfg.RandomSeed, or
+// with the current time if that's zero. It's safe for concurrent use.
+func NewRandom(cfg AppConfig) Random {
+    seed := cfg.RandomSeed
+    if seed == 0 {
+        seed = time.Now().UnixNano()
+    }
+    return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+// NewCryptoRandom constructs a Random backed by crypto/rand.
+func NewCryptoRandom() Random {
+    return crand.Reader
+}
+
+// lockedRand serializes access to a *rand.Rand, which isn't safe for
+// concurrent use on its own.
+type lockedRand struct {
+    mu sync.Mutex
+    r  *rand.Rand
+}
+
+func (l *lockedRand) Read(p []byte) (int, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.r.Read(p)
+}
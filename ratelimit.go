@@ -0,0 +1,162 @@
+package main
+
+import (
+    "context"
+    "math"
+    "net"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+
+    "go.uber.org/fx"
+    "golang.org/x/time/rate"
+)
+
+// Stale per-client limiters are swept every limiterSweepInterval, dropping any
+// that haven't seen a request in limiterIdleTTL.
+const (
+    limiterSweepInterval = time.Minute
+    limiterIdleTTL       = 3 * time.Minute
+)
+
+// RateLimitConfig holds the per-client rate limit. Clients are told apart by
+// IP address, and each gets its own token bucket. A zero Rate disables rate
+// limiting.
+/*
+    RateLimitConfig 保存按客户端的限流设置。客户端按IP地址区分，每个客户端拥有自己的
+    令牌桶。Rate为零时禁用限流。
+*/
+type RateLimitConfig struct {
+    // Rate is the sustained number of requests per second each client may
+    // make.
+    Rate float64 `yaml:"rate"`
+    // Burst is how many requests a client may make at once before Rate
+    // applies. It defaults to Rate, rounded up.
+    Burst int `yaml:"burst"`
+}
+
+func (c RateLimitConfig) enabled() bool {
+    return c.Rate > 0
+}
+
+func (c RateLimitConfig) burst() int {
+    if c.Burst > 0 {
+        return c.Burst
+    }
+    return int(math.Ceil(c.Rate))
+}
+
+// NewRateLimitMiddleware contributes the rate-limiting middleware, if
+// MiddlewareConfig.RateLimit sets a rate. Clients over their limit get a 429
+// with a Retry-After header. Limiters for clients that have gone quiet are
+// cleaned up in the background until the application context is cancelled.
+/*
+    NewRateLimitMiddleware 提供限流中间件（如果MiddlewareConfig.RateLimit设置了速率）。
+    超出限额的客户端会收到带有Retry-After头的429。已经沉寂的客户端的限流器会在后台被清理，
+    直到应用程序context被取消。
+*/
+func NewRateLimitMiddleware(lc fx.Lifecycle, ctx context.Context, cfg MiddlewareConfig, clock Clock) MiddlewareResult {
+    m := Middleware{Name: "rate-limit", Priority: PriorityRateLimit}
+    if cfg.RateLimit.enabled() {
+        l := newRateLimiter(cfg.RateLimit, clock)
+        lc.Append(fx.Hook{
+            OnStart: func(context.Context) error {
+                go l.sweep(ctx, clock.NewTicker(limiterSweepInterval))
+                return nil
+            },
+        })
+        m.Wrap = l.wrap
+    }
+    return MiddlewareResult{Middleware: m}
+}
+
+// rateLimiter keeps one token bucket per client IP.
+type rateLimiter struct {
+    limit rate.Limit
+    burst int
+    clock Clock
+
+    mu      sync.Mutex
+    clients map[string]*clientLimiter
+}
+
+type clientLimiter struct {
+    limiter  *rate.Limiter
+    lastSeen time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig, clock Clock) *rateLimiter {
+    return &rateLimiter{
+        limit:   rate.Limit(cfg.Rate),
+        burst:   cfg.burst(),
+        clock:   clock,
+        clients: make(map[string]*clientLimiter),
+    }
+}
+
+func (l *rateLimiter) wrap(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if wait, ok := l.allow(clientIP(r), l.clock.Now()); !ok {
+            w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+            WriteProblem(w, http.StatusTooManyRequests, "", "")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// allow takes a token from ip's bucket. If there isn't one, it reports how
+// long until there will be.
+func (l *rateLimiter) allow(ip string, now time.Time) (time.Duration, bool) {
+    l.mu.Lock()
+    c, ok := l.clients[ip]
+    if !ok {
+        c = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+        l.clients[ip] = c
+    }
+    c.lastSeen = now
+    l.mu.Unlock()
+
+    res := c.limiter.ReserveN(now, 1)
+    if !res.OK() {
+        // Only possible with a zero burst, which would refuse every request.
+        return time.Second, false
+    }
+    if wait := res.DelayFrom(now); wait > 0 {
+        // Don't make the client pay for a request we're refusing.
+        res.CancelAt(now)
+        return wait, false
+    }
+    return 0, true
+}
+
+// sweep drops idle clients' limiters each time ticker fires, until ctx is
+// done.
+func (l *rateLimiter) sweep(ctx context.Context, ticker Ticker) {
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ticker.C():
+            cutoff := l.clock.Now().Add(-limiterIdleTTL)
+            l.mu.Lock()
+            for ip, c := range l.clients {
+                if c.lastSeen.Before(cutoff) {
+                    delete(l.clients, ip)
+                }
+            }
+            l.mu.Unlock()
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        return r.RemoteAddr
+    }
+    return host
+}
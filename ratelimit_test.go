@@ -0,0 +1,105 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+
+    "go.uber.org/fx/fxtest"
+)
+
+func TestRateLimitHammeredFromOneIP(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    l := newRateLimiter(RateLimitConfig{Rate: 1, Burst: 5}, clock)
+    h := l.wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }))
+    request := func(ip string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(http.MethodGet, "/", nil)
+        req.RemoteAddr = ip + ":1234"
+        rec := httptest.NewRecorder()
+        h.ServeHTTP(rec, req)
+        return rec
+    }
+
+    // The clock stands still, so no tokens come back while the requests
+    // run: exactly the burst gets through.
+    const requests = 50
+    codes := make(chan *httptest.ResponseRecorder, requests)
+    var wg sync.WaitGroup
+    for i := 0; i < requests; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            codes <- request("192.0.2.1")
+        }()
+    }
+    wg.Wait()
+    close(codes)
+    var ok, limited int
+    for rec := range codes {
+        switch rec.Code {
+        case http.StatusOK:
+            ok++
+        case http.StatusTooManyRequests:
+            limited++
+            if got := rec.Header().Get("Retry-After"); got != "1" {
+                t.Errorf("429 Retry-After = %q, want \"1\"", got)
+            }
+        default:
+            t.Errorf("unexpected status %d", rec.Code)
+        }
+    }
+    if ok != 5 || limited != requests-5 {
+        t.Errorf("%d requests from one IP: %d allowed, %d limited; want 5 and %d", requests, ok, limited, requests-5)
+    }
+
+    if rec := request("192.0.2.2"); rec.Code != http.StatusOK {
+        t.Errorf("another IP got %d, want 200", rec.Code)
+    }
+    clock.Advance(time.Second)
+    if rec := request("192.0.2.1"); rec.Code != http.StatusOK {
+        t.Errorf("after a second, got %d, want 200", rec.Code)
+    }
+    if rec := request("192.0.2.1"); rec.Code != http.StatusTooManyRequests {
+        t.Errorf("second request after a second got %d, want 429", rec.Code)
+    }
+}
+
+func TestRateLimitDisabledAtZeroRate(t *testing.T) {
+    m := NewRateLimitMiddleware(fxtest.NewLifecycle(t), t.Context(), NewMiddlewareConfig(), NewClock()).Middleware
+    if m.Wrap != nil {
+        t.Error("NewRateLimitMiddleware contributed a middleware with a zero rate")
+    }
+}
+
+func TestRateLimitSweepsIdleClients(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    l := newRateLimiter(RateLimitConfig{Rate: 1}, clock)
+    l.allow("192.0.2.1", clock.Now())
+    go l.sweep(t.Context(), clock.NewTicker(limiterSweepInterval))
+    clients := func() int {
+        l.mu.Lock()
+        defer l.mu.Unlock()
+        return len(l.clients)
+    }
+
+    for elapsed := limiterSweepInterval; elapsed <= limiterIdleTTL; elapsed += limiterSweepInterval {
+        clock.Advance(limiterSweepInterval)
+    }
+    // The client was last seen exactly limiterIdleTTL ago: not yet idle.
+    time.Sleep(10 * time.Millisecond)
+    if n := clients(); n != 1 {
+        t.Fatalf("%d limiter(s) after %s, want the client's kept", n, limiterIdleTTL)
+    }
+    clock.Advance(limiterSweepInterval)
+    deadline := time.Now().Add(5 * time.Second)
+    for clients() != 0 {
+        if time.Now().After(deadline) {
+            t.Fatal("the idle client's limiter was never swept")
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "net"
+    "net/http"
+)
+
+// statusRecorder wraps an http.ResponseWriter to remember the status code and
+// number of body bytes the handler wrote, so middleware (metrics, access logs,
+// recovery) can observe them after the handler returns.
+//
+// Once a response has started - with WriteHeader, Write or Flush - further
+// WriteHeader calls are dropped rather than passed on, where net/http (or
+// http.TimeoutHandler) would log a "superfluous WriteHeader call" for each.
+// Register hands every handler one (see guardWrites), so the guard sits
+// where the handler's own writes land.
+//
+// It passes http.Flusher and http.Hijacker through to the underlying writer,
+// so wrapping a handler doesn't break streaming responses or WebSocket
+// upgrades.
+/*
+    statusRecorder 包装http.ResponseWriter，记录handler写入的状态码和响应体字节数，
+    以便中间件（指标、访问日志、恢复）在handler返回后观察它们。
+
+    响应一旦开始（通过WriteHeader、Write或Flush），之后的WriteHeader调用会被丢弃而不是
+    继续传递，否则net/http（或http.TimeoutHandler）会为每次调用记录一条"superfluous
+    WriteHeader call"。Register为每个handler提供一个statusRecorder（参见guardWrites），
+    因此这一保护位于handler自身写入的位置。
+
+    它将http.Flusher和http.Hijacker透传给底层的writer，因此包装handler不会破坏流式
+    响应或WebSocket升级。
+*/
+type statusRecorder struct {
+    http.ResponseWriter
+    Status int
+    Bytes  int
+    // wroteHeader is set once the status line has gone out, explicitly or
+    // with the first Write or Flush.
+    wroteHeader bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+    // A handler that never calls WriteHeader gets an implicit 200.
+    return &statusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+    // Informational responses can precede the real one, as often as the
+    // handler likes.
+    if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+        r.ResponseWriter.WriteHeader(status)
+        return
+    }
+    if r.wroteHeader {
+        return
+    }
+    r.wroteHeader = true
+    r.Status = status
+    r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+    r.wroteHeader = true
+    n, err := r.ResponseWriter.Write(b)
+    r.Bytes += n
+    return n, err
+}
+
+// Flush implements http.Flusher if the underlying writer does.
+func (r *statusRecorder) Flush() {
+    r.wroteHeader = true
+    if f, ok := r.ResponseWriter.(http.Flusher); ok {
+        f.Flush()
+    }
+}
+
+// Hijack implements http.Hijacker if the underlying writer does. A hijacked
+// connection is switching protocols, so that's the status we record.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+    h, ok := r.ResponseWriter.(http.Hijacker)
+    if !ok {
+        return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", r.ResponseWriter)
+    }
+    conn, rw, err := h.Hijack()
+    if err == nil {
+        r.Status, r.wroteHeader = http.StatusSwitchingProtocols, true
+    }
+    return conn, rw, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+    return r.ResponseWriter
+}
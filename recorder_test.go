@@ -0,0 +1,52 @@
+package main
+
+import (
+    "bufio"
+    "io"
+    "net"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestHijackThroughMiddleware(t *testing.T) {
+    app := newTestApp(t, nil,
+        testRoute(Route{Path: "/ws", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            conn, rw, err := http.NewResponseController(w).Hijack()
+            if err != nil {
+                WriteProblem(w, http.StatusInternalServerError, "", err.Error())
+                return
+            }
+            defer conn.Close()
+            io.WriteString(rw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+            rw.Flush()
+            line, _ := rw.ReadString('\n')
+            io.WriteString(rw, line)
+            rw.Flush()
+        })}),
+    ).start()
+    if NewAppConfig().Middleware.RequestTimeout <= 0 {
+        t.Fatal("the default configuration has no request timeout to bypass")
+    }
+
+    conn, err := net.Dial("tcp", strings.TrimPrefix(app.URL(), "http://"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+    br := bufio.NewReader(conn)
+    resp, err := http.ReadResponse(br, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if resp.StatusCode != http.StatusSwitchingProtocols {
+        body, _ := io.ReadAll(resp.Body)
+        t.Fatalf("upgrade = %s %q, want 101", resp.Status, body)
+    }
+
+    io.WriteString(conn, "ping\n")
+    if line, err := br.ReadString('\n'); err != nil || line != "ping\n" {
+        t.Errorf("echo over the hijacked connection = %q, %v; want \"ping\\n\"", line, err)
+    }
+}
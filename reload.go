@@ -0,0 +1,103 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "sync/atomic"
+)
+
+// LiveConfig holds the AppConfig currently in effect. Most of the graph is
+// built once from the AppConfig NewConfig loaded, but a few settings can be
+// changed while the application runs (see SignalHandler); the code that uses
+// those reads them from LiveConfig on each use rather than capturing them at
+// construction.
+/*
+    LiveConfig 保存当前生效的AppConfig。依赖图的大部分只会根据NewConfig加载的AppConfig
+    构建一次，但有少数设置可以在应用程序运行时更改（参见SignalHandler）；使用这些设置的
+    代码每次使用时都从LiveConfig读取，而不是在构造时捕获它们。
+*/
+type LiveConfig struct {
+    cfg atomic.Pointer[AppConfig]
+}
+
+// NewLiveConfig constructs a LiveConfig holding cfg.
+func NewLiveConfig(cfg AppConfig) *LiveConfig {
+    l := &LiveConfig{}
+    l.cfg.Store(&cfg)
+    return l
+}
+
+// Load returns the configuration currently in effect.
+func (l *LiveConfig) Load() AppConfig {
+    return *l.cfg.Load()
+}
+
+// reloadable copies the settings that take effect without a restart from
+// next onto cur: the log level, the request timeout and the request body
+// limit.
+func reloadable(cur, next AppConfig) AppConfig {
+    cur.Log.Level = next.Log.Level
+    cur.Middleware.RequestTimeout = next.Middleware.RequestTimeout
+    cur.Middleware.MaxBodyBytes = next.Middleware.MaxBodyBytes
+    return cur
+}
+
+// restartRequired lists the settings that differ between cur and next but
+// only take effect on restart: every field of AppConfig, bar the reloadable
+// ones, named by its path in the config file. A nested section is named
+// setting by setting, so the warning says which one changed.
+func restartRequired(cur, next AppConfig) []string {
+    return changedFields(reflect.ValueOf(reloadable(cur, next)), reflect.ValueOf(next), "")
+}
+
+// changedFields names the fields that differ between the structs a and b,
+// descending into the sections of AppConfig (but no further).
+func changedFields(a, b reflect.Value, prefix string) []string {
+    var fields []string
+    for i := 0; i < a.NumField(); i++ {
+        x, y := a.Field(i), b.Field(i)
+        if reflect.DeepEqual(x.Interface(), y.Interface()) {
+            continue
+        }
+        name := prefix + yamlName(a.Type().Field(i))
+        if x.Kind() == reflect.Struct && prefix == "" {
+            fields = append(fields, changedFields(x, y, name+".")...)
+            continue
+        }
+        fields = append(fields, name)
+    }
+    return fields
+}
+
+// yamlName returns the name f goes by in the config file.
+func yamlName(f reflect.StructField) string {
+    if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name != "" {
+        return name
+    }
+    return strings.ToLower(f.Name)
+}
+
+// reloadConfig re-reads the config file and environment with NewConfig and
+// applies the hot-reloadable settings - the log level, the request timeout
+// and the request body limit - in place. Anything else that changed, such as
+// the listen address, is logged as needing a restart. A file that no longer
+// parses or validates is logged and the current configuration kept.
+func reloadConfig(live *LiveConfig, logger *LeveledLogger) {
+    next, err := NewConfig()
+    if err == nil {
+        err = next.Validate()
+    }
+    if err != nil {
+        logger.Errorf("Reloading configuration: %v; keeping the current one.", err)
+        return
+    }
+    cur := live.Load()
+    for _, field := range restartRequired(cur, next) {
+        logger.Warnf("Configuration change to %s requires a restart to take effect.", field)
+    }
+    cfg := reloadable(cur, next)
+    live.cfg.Store(&cfg)
+    logger.SetLevel(cfg.Log.Level)
+    logger.Infof("Reloaded configuration: log_level=%s request_timeout=%s max_body_bytes=%d.",
+        cfg.Log.Level, cfg.Middleware.RequestTimeout, cfg.Middleware.MaxBodyBytes)
+}
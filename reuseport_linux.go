@@ -0,0 +1,25 @@
+//go:build linux
+
+package main
+
+import (
+    "syscall"
+
+    "golang.org/x/sys/unix"
+)
+
+// reusePortSupported reports whether ServerConfig.ReusePort has any effect
+// on this platform.
+const reusePortSupported = true
+
+// reusePortControl sets SO_REUSEPORT on a listening socket before it's bound.
+func reusePortControl(_, _ string, c syscall.RawConn) error {
+    var sockErr error
+    err := c.Control(func(fd uintptr) {
+        sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+    })
+    if err != nil {
+        return err
+    }
+    return sockErr
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// reusePortSupported reports whether ServerConfig.ReusePort has any effect
+// on this platform.
+const reusePortSupported = false
+
+// reusePortControl is never called where SO_REUSEPORT isn't supported.
+func reusePortControl(_, _ string, _ syscall.RawConn) error {
+    return nil
+}
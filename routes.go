@@ -0,0 +1,209 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "reflect"
+    "runtime"
+    "slices"
+    "sort"
+    "strings"
+    "time"
+
+    "go.uber.org/fx"
+)
+
+// Route pairs a path with the handler mounted on it.
+/*
+    Route 将路径与挂载在其上的handler配对。
+*/
+type Route struct {
+    Path    string
+    Handler http.Handler
+
+    // Method restricts the route to one HTTP method; other methods get a 405
+    // listing the allowed ones. GET routes answer HEAD too. Empty matches any
+    // method.
+    Method string
+
+    // Server names the server (see NamedServer) to mount the route on. The
+    // default, empty name is the server built by NewMux.
+    Server string
+
+    // NoTimeout exempts the route from MiddlewareConfig.RequestTimeout, for
+    // handlers that legitimately run long. Upgrade requests are always
+    // exempt, so a WebSocket handler can hijack the connection without it.
+    NoTimeout bool
+
+    // Protected requires HTTP Basic authentication with the credentials in
+    // MiddlewareConfig.BasicAuth.
+    Protected bool
+
+    // MaxBodyBytes overrides MiddlewareConfig.MaxBodyBytes for this route,
+    // e.g. for uploads. Zero keeps the default; negative removes the cap.
+    MaxBodyBytes int64
+
+    // MaxConcurrent caps how many requests this route handles at once, on
+    // top of MiddlewareConfig.Concurrency. Zero means no cap of its own.
+    MaxConcurrent int
+
+    // Cacheable caches the route's 200 responses to GET requests, keyed by
+    // path and query, for CacheTTL (MiddlewareConfig.CacheTTL if zero). Only
+    // set it for routes whose response doesn't depend on anything else about
+    // the request.
+    Cacheable bool
+    CacheTTL  time.Duration
+
+    // Audit logs the route's request and response bodies to the audit log
+    // (see AuditLogger), up to MiddlewareConfig.Audit.MaxBodyBytes each.
+    Audit bool
+}
+
+// RouteResult adds a Route to the "routes" value group. Any constructor can
+// return one (embedding fx.Out makes Fx treat each tagged field as a separate
+// result), and Register will mount every Route in the group.
+//
+// By default Fx allows only one constructor per type; value groups are the way
+// around that restriction when many constructors contribute the same type.
+/*
+    RouteResult 将一个Route添加到"routes"值组中。任何构造函数都可以返回它（嵌入fx.Out
+    会让Fx将每个带标签的字段视为单独的结果），Register会挂载组中的每个Route。
+
+    默认情况下，Fx每种类型只允许一个构造函数；当多个构造函数提供同一类型时，值组是
+    绕过该限制的方法。
+*/
+type RouteResult struct {
+    fx.Out
+
+    Route Route `group:"routes"`
+}
+
+// RoutesResult adds any number of Routes - including none - to the "routes"
+// value group, for constructors whose routes are optional.
+/*
+    RoutesResult 向"routes"值组添加任意数量的Route（包括零个），用于路由是可选的构造函数。
+*/
+type RoutesResult struct {
+    fx.Out
+
+    Routes []Route `group:"routes,flatten"`
+}
+
+// maxBodyBytes returns the body size limit for the route given the default.
+func (r Route) maxBodyBytes(def int64) int64 {
+    if r.MaxBodyBytes != 0 {
+        return r.MaxBodyBytes
+    }
+    return def
+}
+
+// describe returns the route's method and path, for logs and errors.
+func (r Route) describe() string {
+    if r.Method == "" {
+        return r.Path
+    }
+    return r.Method + " " + r.Path
+}
+
+// withPrefix returns r as mounted under MiddlewareConfig.PathPrefix: its
+// path prefixed and, with StripPrefix, its handler seeing the path without
+// the prefix. Routes on named servers and paths listed in UnprefixedPaths are
+// returned as they are.
+func (r Route) withPrefix(cfg MiddlewareConfig) Route {
+    if cfg.PathPrefix == "" || r.Server != "" || slices.Contains(cfg.UnprefixedPaths, r.Path) {
+        return r
+    }
+    r.Path = cfg.PathPrefix + r.Path
+    if cfg.StripPrefix {
+        r.Handler = http.StripPrefix(cfg.PathPrefix, r.Handler)
+    }
+    return r
+}
+
+// methodRouter dispatches requests for one path to the handler registered for
+// their method. The standard library's ServeMux only matches on paths; this is
+// the thin layer on top that gives Routes REST-style method matching.
+type methodRouter struct {
+    methods map[string]http.Handler
+    // any handles every method, for routes that don't set one.
+    any http.Handler
+
+    // sources names the handler registered for each method ("" for any), so
+    // conflicts can say what they conflict with.
+    sources map[string]string
+}
+
+func newMethodRouter() *methodRouter {
+    return &methodRouter{
+        methods: make(map[string]http.Handler),
+        sources: make(map[string]string),
+    }
+}
+
+// add registers h, named source, for method, or for every method if method is
+// empty.
+func (m *methodRouter) add(method string, h http.Handler, source string) error {
+    method = strings.ToUpper(method)
+    if existing, ok := m.sources[method]; ok {
+        return fmt.Errorf("conflicts with %s, already registered for the same path and method", existing)
+    }
+    m.sources[method] = source
+    if method == "" {
+        m.any = h
+    } else {
+        m.methods[method] = h
+    }
+    return nil
+}
+
+// handlerName identifies h in error messages. Handlers built from functions
+// are named after the function - for a closure, the constructor that
+// returned it, such as "main.NewHandler.func1" - and others after their type.
+func handlerName(h http.Handler) string {
+    if f, ok := h.(http.HandlerFunc); ok {
+        if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+            return fn.Name()
+        }
+    }
+    return fmt.Sprintf("%T", h)
+}
+
+// handler returns the http.Handler to mount: the route's own handler when
+// there's nothing to dispatch, or the router itself.
+func (m *methodRouter) handler() http.Handler {
+    if len(m.methods) == 0 {
+        return m.any
+    }
+    return m
+}
+
+func (m *methodRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    h, ok := m.methods[r.Method]
+    if !ok && r.Method == http.MethodHead {
+        h, ok = m.methods[http.MethodGet]
+    }
+    if !ok {
+        h, ok = m.any, m.any != nil
+    }
+    if !ok {
+        w.Header().Set("Allow", m.allow())
+        WriteProblem(w, http.StatusMethodNotAllowed, "", r.Method+" is not allowed; try "+m.allow())
+        return
+    }
+    h.ServeHTTP(w, r)
+}
+
+// allow lists the methods the router answers, for the Allow header.
+func (m *methodRouter) allow() string {
+    allowed := make([]string, 0, len(m.methods)+1)
+    for method := range m.methods {
+        allowed = append(allowed, method)
+    }
+    if _, ok := m.methods[http.MethodGet]; ok {
+        if _, ok := m.methods[http.MethodHead]; !ok {
+            allowed = append(allowed, http.MethodHead)
+        }
+    }
+    sort.Strings(allowed)
+    return strings.Join(allowed, ", ")
+}
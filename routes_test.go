@@ -0,0 +1,58 @@
+package main
+
+import (
+    "io"
+    "net/http"
+    "testing"
+)
+
+// pathRoute is a route on path that writes back the path its handler sees.
+func pathRoute(path string) Route {
+    return Route{Path: path, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        io.WriteString(w, r.URL.Path)
+    })}
+}
+
+func TestPathPrefix(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) { c.Middleware.PathPrefix = "/api" },
+        testRoute(pathRoute("/whoami")),
+    ).start()
+
+    if resp, body := app.get("/api/whoami"); resp.StatusCode != http.StatusOK || body != "/api/whoami" {
+        t.Errorf("GET /api/whoami = %s %q, want 200 with the full path", resp.Status, body)
+    }
+    if resp, _ := app.get("/whoami"); resp.StatusCode != http.StatusNotFound {
+        t.Errorf("GET /whoami = %s, want 404 outside the prefix", resp.Status)
+    }
+    // Unprefixed paths stay where they are.
+    if resp, _ := app.get("/healthz"); resp.StatusCode != http.StatusOK {
+        t.Errorf("GET /healthz = %s, want 200 outside the prefix", resp.Status)
+    }
+    // The health check's 200 is empty; under the prefix, "/api/" answers
+    // with the greeting instead.
+    if resp, body := app.get("/api/healthz"); body == "" {
+        t.Errorf("GET /api/healthz = %s %q, want the health check left unprefixed", resp.Status, body)
+    }
+}
+
+func TestPathPrefixStripped(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) {
+        c.Middleware.PathPrefix = "/api"
+        c.Middleware.StripPrefix = true
+    }, testRoute(pathRoute("/whoami"))).start()
+
+    if resp, body := app.get("/api/whoami"); resp.StatusCode != http.StatusOK || body != "/whoami" {
+        t.Errorf("GET /api/whoami = %s %q, want 200 with the prefix stripped", resp.Status, body)
+    }
+}
+
+func TestPathPrefixMovesListedPaths(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) {
+        c.Middleware.PathPrefix = "/api"
+        c.Middleware.UnprefixedPaths = nil
+    }).start()
+
+    if resp, body := app.get("/api/healthz"); resp.StatusCode != http.StatusOK || body != "" {
+        t.Errorf("GET /api/healthz = %s %q, want the health check's empty 200 with no unprefixed paths", resp.Status, body)
+    }
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "go.uber.org/fx"
+)
+
+// Policies for a job still running when its next run is due, selected by
+// AppConfig.JobOverrun. Either way the overdue run is skipped, rather than
+// piling runs up behind a slow one; the policy only decides how loudly.
+const (
+    // JobOverrunSkip skips it, noting so at DEBUG.
+    JobOverrunSkip = "skip"
+    // JobOverrunWarn skips it with a WARN, for jobs whose interval is meant
+    // to be comfortably longer than they take.
+    JobOverrunWarn = "warn"
+)
+
+// Job is a function the Scheduler runs every Interval, starting one Interval
+// after the application starts. Run's context is cancelled when the
+// application stops; an error is logged, and the job runs again on schedule.
+/*
+    Job 是Scheduler每隔Interval运行一次的函数，第一次运行在应用程序启动一个Interval之后。
+    应用程序停止时Run的context会被取消；返回的错误会被记录，作业仍按计划再次运行。
+*/
+type Job struct {
+    Name     string
+    Interval time.Duration
+    Run      func(context.Context) error
+}
+
+// JobResult adds a Job to the "jobs" value group, so any module can schedule
+// background work without touching the Scheduler.
+/*
+    JobResult 将一个Job添加到"jobs"值组中，因此任何模块都可以调度后台工作而无需修改
+    Scheduler。
+*/
+type JobResult struct {
+    fx.Out
+
+    Job Job `group:"jobs"`
+}
+
+// SchedulerParams are NewScheduler's dependencies.
+type SchedulerParams struct {
+    fx.In
+
+    Lifecycle fx.Lifecycle
+    Context   context.Context
+    Config    AppConfig
+    Logger    *LeveledLogger
+    Clock     Clock
+    Jobs      []Job `group:"jobs"`
+}
+
+// Scheduler runs the jobs in the "jobs" group, each on its own ticker from the
+// Clock, so a test with a FakeClock decides when jobs are due. It's
+// cron-like background work under the Lifecycle: the tickers start in
+// OnStart, and OnStop cancels the running jobs' context and waits, until the
+// stop deadline, for them to return.
+/*
+    Scheduler 运行"jobs"组中的作业，每个作业使用Clock提供的各自的ticker，因此使用
+    FakeClock的测试可以决定作业何时到期。它是Lifecycle管理下的类cron后台工作：ticker
+    在OnStart中启动，OnStop取消正在运行的作业的context，并在停止期限内等待它们返回。
+*/
+type Scheduler struct {
+    jobs    []Job
+    overrun string
+    logger  *LeveledLogger
+    clock   Clock
+
+    ctx    context.Context
+    cancel context.CancelFunc
+    wg     sync.WaitGroup
+}
+
+// NewScheduler constructs the Scheduler, failing on a job without a positive
+// Interval.
+func NewScheduler(p SchedulerParams) (*Scheduler, error) {
+    for _, job := range p.Jobs {
+        if job.Interval <= 0 {
+            return nil, fmt.Errorf("job %s: interval must be positive, got %s", job.Name, job.Interval)
+        }
+    }
+    s := &Scheduler{jobs: p.Jobs, overrun: p.Config.JobOverrun, logger: p.Logger, clock: p.Clock}
+    s.ctx, s.cancel = context.WithCancel(p.Context)
+    p.Lifecycle.Append(fx.Hook{
+        OnStart: func(context.Context) error {
+            for _, job := range s.jobs {
+                p.Logger.Infof("Scheduling job %s every %s.", job.Name, job.Interval)
+                s.wg.Add(1)
+                go s.schedule(job)
+            }
+            return nil
+        },
+        OnStop: func(ctx context.Context) error {
+            s.cancel()
+            done := make(chan struct{})
+            go func() {
+                s.wg.Wait()
+                close(done)
+            }()
+            select {
+            case <-done:
+                return nil
+            case <-ctx.Done():
+                return fmt.Errorf("waiting for scheduled jobs: %w", ctx.Err())
+            }
+        },
+    })
+    return s, nil
+}
+
+// schedule runs job on its ticker until the scheduler stops.
+func (s *Scheduler) schedule(job Job) {
+    defer s.wg.Done()
+    ticker := s.clock.NewTicker(job.Interval)
+    defer ticker.Stop()
+    var running atomic.Bool
+    for {
+        select {
+        case <-ticker.C():
+            if !running.CompareAndSwap(false, true) {
+                if s.overrun == JobOverrunWarn {
+                    s.logger.Warnf("Job %s is still running after %s; skipping this run.", job.Name, job.Interval)
+                } else {
+                    s.logger.Debugf("Job %s is still running; skipping this run.", job.Name)
+                }
+                continue
+            }
+            s.wg.Add(1)
+            go func() {
+                defer s.wg.Done()
+                defer running.Store(false)
+                if err := job.Run(s.ctx); err != nil && s.ctx.Err() == nil {
+                    s.logger.Errorf("Job %s: %v", job.Name, err)
+                }
+            }()
+        case <-s.ctx.Done():
+            return
+        }
+    }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "go.uber.org/fx/fxtest"
+)
+
+func TestSchedulerRunsJobAtInterval(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    runs := make(chan time.Time, 10)
+    lc := fxtest.NewLifecycle(t)
+    _, err := NewScheduler(SchedulerParams{
+        Lifecycle: lc,
+        Context:   t.Context(),
+        Config:    NewAppConfig(),
+        Logger:    discardLogger(),
+        Clock:     clock,
+        Jobs: []Job{{
+            Name:     "tick",
+            Interval: time.Minute,
+            Run: func(context.Context) error {
+                runs <- clock.Now()
+                return nil
+            },
+        }},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    lc.RequireStart()
+    defer lc.RequireStop()
+    waitForTickers(t, clock, 1)
+
+    clock.Advance(59 * time.Second)
+    select {
+    case at := <-runs:
+        t.Fatalf("job ran at %s, before its interval", at)
+    case <-time.After(50 * time.Millisecond):
+    }
+
+    start := clock.Now().Add(-59 * time.Second)
+    for i := 1; i <= 3; i++ {
+        clock.Set(start.Add(time.Duration(i) * time.Minute))
+        select {
+        case at := <-runs:
+            if want := start.Add(time.Duration(i) * time.Minute); !at.Equal(want) {
+                t.Errorf("run %d at %s, want %s", i, at, want)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("job didn't run after %d interval(s)", i)
+        }
+    }
+}
+
+func TestSchedulerRejectsNonPositiveInterval(t *testing.T) {
+    _, err := NewScheduler(SchedulerParams{
+        Lifecycle: fxtest.NewLifecycle(t),
+        Context:   t.Context(),
+        Config:    NewAppConfig(),
+        Logger:    discardLogger(),
+        Clock:     NewClock(),
+        Jobs:      []Job{{Name: "never", Run: func(context.Context) error { return nil }}},
+    })
+    if err == nil {
+        t.Error("NewScheduler accepted a job without an interval")
+    }
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// DefaultHSTSMaxAge is the Strict-Transport-Security max-age
+// NewSecurityHeadersConfig applies: 180 days.
+const DefaultHSTSMaxAge = 180 * 24 * time.Hour
+
+// SecurityHeadersConfig holds the values of the security headers set on every
+// response. An empty value leaves its header out, so a config file can turn
+// any of the defaults off by setting it to "".
+/*
+    SecurityHeadersConfig 保存为每个响应设置的安全头的值。值为空时不设置对应的头，因此
+    配置文件可以通过将其设置为""来关闭任意默认值。
+*/
+type SecurityHeadersConfig struct {
+    // ContentTypeOptions is the X-Content-Type-Options value; "nosniff" by
+    // default.
+    ContentTypeOptions string `yaml:"content_type_options"`
+    // FrameOptions is the X-Frame-Options value; "DENY" by default.
+    FrameOptions string `yaml:"frame_options"`
+    // ReferrerPolicy is the Referrer-Policy value;
+    // "strict-origin-when-cross-origin" by default.
+    ReferrerPolicy string `yaml:"referrer_policy"`
+    // ContentSecurityPolicy is the Content-Security-Policy value;
+    // "default-src 'self'; frame-ancestors 'none'" by default.
+    ContentSecurityPolicy string `yaml:"content_security_policy"`
+
+    // HSTSMaxAge is the max-age of the Strict-Transport-Security header,
+    // which is only ever sent over TLS: browsers ignore it over plain HTTP,
+    // and a plain-HTTP server has no business promising HTTPS. Zero leaves
+    // it out.
+    HSTSMaxAge time.Duration `yaml:"hsts_max_age"`
+    // HSTSIncludeSubdomains extends the promise to every subdomain.
+    HSTSIncludeSubdomains bool `yaml:"hsts_include_subdomains"`
+}
+
+// NewSecurityHeadersConfig constructs the default SecurityHeadersConfig.
+func NewSecurityHeadersConfig() SecurityHeadersConfig {
+    return SecurityHeadersConfig{
+        ContentTypeOptions:    "nosniff",
+        FrameOptions:          "DENY",
+        ReferrerPolicy:        "strict-origin-when-cross-origin",
+        ContentSecurityPolicy: "default-src 'self'; frame-ancestors 'none'",
+        HSTSMaxAge:            DefaultHSTSMaxAge,
+    }
+}
+
+// NewSecurityHeadersMiddleware contributes the middleware that sets the
+// headers in MiddlewareConfig.SecurityHeaders. It runs outermost, so even
+// responses written by other middleware - a 429, a 503 - carry them; handlers
+// that need a different value for a header can still set their own.
+/*
+    NewSecurityHeadersMiddleware 提供设置MiddlewareConfig.SecurityHeaders中各个头的
+    中间件。它位于最外层，因此即使是其他中间件写出的响应（429、503）也带有这些头；需要
+    不同取值的handler仍可以自行设置。
+*/
+func NewSecurityHeadersMiddleware(cfg MiddlewareConfig) MiddlewareResult {
+    headers := cfg.SecurityHeaders
+    set := map[string]string{
+        "X-Content-Type-Options":  headers.ContentTypeOptions,
+        "X-Frame-Options":         headers.FrameOptions,
+        "Referrer-Policy":         headers.ReferrerPolicy,
+        "Content-Security-Policy": headers.ContentSecurityPolicy,
+    }
+    for name, value := range set {
+        if value == "" {
+            delete(set, name)
+        }
+    }
+    var hsts string
+    if headers.HSTSMaxAge > 0 {
+        hsts = "max-age=" + strconv.FormatInt(int64(headers.HSTSMaxAge/time.Second), 10)
+        if headers.HSTSIncludeSubdomains {
+            hsts += "; includeSubDomains"
+        }
+    }
+
+    m := Middleware{Name: "security-headers", Priority: PrioritySecurityHeaders}
+    if len(set) > 0 || hsts != "" {
+        m.Wrap = func(next http.Handler) http.Handler {
+            return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                h := w.Header()
+                for name, value := range set {
+                    h.Set(name, value)
+                }
+                if hsts != "" && r.TLS != nil {
+                    h.Set("Strict-Transport-Security", hsts)
+                }
+                next.ServeHTTP(w, r)
+            })
+        }
+    }
+    return MiddlewareResult{Middleware: m}
+}
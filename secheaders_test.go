@@ -0,0 +1,64 @@
+package main
+
+import (
+    "crypto/tls"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// securityHeaders serves a request, over TLS if tls is set, through the
+// security headers middleware built from cfg.
+func securityHeaders(cfg SecurityHeadersConfig, overTLS bool) http.Header {
+    mw := NewMiddlewareConfig()
+    mw.SecurityHeaders = cfg
+    h := NewSecurityHeadersMiddleware(mw).Middleware.Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }))
+    req := httptest.NewRequest(http.MethodGet, "/", nil)
+    if overTLS {
+        req.TLS = &tls.ConnectionState{}
+    }
+    rec := httptest.NewRecorder()
+    h.ServeHTTP(rec, req)
+    return rec.Header()
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+    got := securityHeaders(NewSecurityHeadersConfig(), false)
+    for name, want := range map[string]string{
+        "X-Content-Type-Options":  "nosniff",
+        "X-Frame-Options":         "DENY",
+        "Referrer-Policy":         "strict-origin-when-cross-origin",
+        "Content-Security-Policy": "default-src 'self'; frame-ancestors 'none'",
+    } {
+        if got.Get(name) != want {
+            t.Errorf("%s = %q, want %q", name, got.Get(name), want)
+        }
+    }
+    if hsts := got.Get("Strict-Transport-Security"); hsts != "" {
+        t.Errorf("Strict-Transport-Security = %q over plain HTTP, want none", hsts)
+    }
+}
+
+func TestSecurityHeadersHSTSOverTLS(t *testing.T) {
+    cfg := NewSecurityHeadersConfig()
+    cfg.HSTSIncludeSubdomains = true
+    want := "max-age=15552000; includeSubDomains"
+    if got := securityHeaders(cfg, true).Get("Strict-Transport-Security"); got != want {
+        t.Errorf("Strict-Transport-Security = %q over TLS, want %q", got, want)
+    }
+}
+
+func TestSecurityHeadersOverridden(t *testing.T) {
+    cfg := NewSecurityHeadersConfig()
+    cfg.FrameOptions = "SAMEORIGIN"
+    cfg.ContentSecurityPolicy = ""
+    got := securityHeaders(cfg, false)
+    if v := got.Get("X-Frame-Options"); v != "SAMEORIGIN" {
+        t.Errorf("X-Frame-Options = %q, want the configured \"SAMEORIGIN\"", v)
+    }
+    if _, ok := got["Content-Security-Policy"]; ok {
+        t.Errorf("Content-Security-Policy set to %q, want it left out", got.Get("Content-Security-Policy"))
+    }
+}
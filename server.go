@@ -0,0 +1,81 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+
+    "go.uber.org/fx"
+)
+
+// NamedMux is a named server's mux, as collected by Register through the
+// "muxes" value group.
+/*
+    NamedMux 是命名服务器的mux，Register通过"muxes"值组收集它们。
+*/
+type NamedMux struct {
+    Name string
+    Mux  *http.ServeMux
+}
+
+// NamedServer adds a second, independently configured HTTP server to the
+// application - say, an admin server on :9090 next to the public one. It has
+// its own mux, http.Server and Lifecycle hooks, built exactly like NewMux's,
+// and it starts and stops together with the others in the ServerGroup.
+//
+// Named tags and value groups combine as follows. The server's configuration
+// is looked up by name, so provide it with a matching tag:
+//
+//   fx.Provide(fx.Annotate(
+//       func() ServerConfig { return ServerConfig{Addr: ":9090"} },
+//       fx.ResultTags(`name:"admin"`),
+//   )),
+//   NamedServer("admin"),
+//
+// (an optional TLSConfig, *http.Server or ListenFunc is looked up the same
+// way). The resulting mux is
+// provided under the same name, `name:"admin"`, for anything that wants to
+// use it directly, and also added to the "muxes" value group so Register can
+// find it. Routes in the "routes" group then target it by setting
+// Route.Server to "admin".
+/*
+    NamedServer 为应用程序添加第二个独立配置的HTTP服务器，比如与公共服务器并存的
+    :9090上的admin服务器。它拥有自己的mux、http.Server和Lifecycle hooks，构建方式与
+    NewMux完全相同，并与ServerGroup中的其他服务器一起启动和停止。
+
+    命名标签和值组的组合方式如下。服务器的配置按名称查找，因此需要用匹配的标签提供它：
+
+      fx.Provide(fx.Annotate(
+          func() ServerConfig { return ServerConfig{Addr: ":9090"} },
+          fx.ResultTags(`name:"admin"`),
+      )),
+      NamedServer("admin"),
+
+    （可选的TLSConfig、*http.Server或ListenFunc也以同样的方式查找）。生成的mux以相同的名称`name:"admin"`提供给
+    需要直接使用它的地方，同时也被添加到"muxes"值组中，以便Register能够找到它。然后
+    "routes"组中的路由通过将Route.Server设置为"admin"来指定它。
+*/
+func NamedServer(name string) fx.Option {
+    tag := fmt.Sprintf(`name:"%s"`, name)
+    return fx.Provide(fx.Annotate(
+        func(lc fx.Lifecycle, ctx context.Context, logger *LeveledLogger, inflight *InFlight, servers *ServerGroup, conns *ConnStats, reload *ReloadHooks, _ DBReady, cfg ServerConfig, tlsCfg TLSConfig, server *http.Server, listen ListenFunc) (*http.ServeMux, NamedMux) {
+            mux := newMux(MuxParams{
+                Lifecycle: lc,
+                Context:   ctx,
+                Logger:    logger,
+                InFlight:  inflight,
+                Servers:   servers,
+                Conns:     conns,
+                Reload:    reload,
+                Config:    cfg,
+                TLS:       tlsCfg,
+                Server:    server,
+                Listen:    listen,
+            }, name)
+            return mux, NamedMux{Name: name, Mux: mux}
+        },
+        fx.ParamTags(``, ``, ``, ``, ``, ``, ``, `optional:"true"`,
+            tag, tag+` optional:"true"`, tag+` optional:"true"`, tag+` optional:"true"`),
+        fx.ResultTags(tag, `group:"muxes"`),
+    ))
+}
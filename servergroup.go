@@ -0,0 +1,129 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "sync"
+
+    "go.uber.org/fx"
+)
+
+// ServerGroup starts and stops every HTTP server in the application - the
+// default one and any added with NamedServer - as a unit. Rather than each
+// server registering its own Lifecycle hooks, newMux adds the server's hook
+// to the group, and the group registers a single hook that runs all of them
+// concurrently, so a slow listener or drain doesn't hold up the others.
+//
+// If any server fails to start, the ones that did start are stopped again
+// before the error is returned, so startup either brings up every server or
+// leaves none running. Errors from all servers are combined with errors.Join.
+/*
+    ServerGroup 将应用程序中的所有HTTP服务器（默认服务器以及通过NamedServer添加的服务
+    器）作为一个整体启动和停止。newMux不再让每个服务器注册自己的Lifecycle hooks，而是
+    把服务器的hook添加到组中，由组注册单个hook并发运行所有hook，这样一个较慢的listener
+    或排空过程不会拖住其他服务器。
+
+    如果任何服务器启动失败，已经启动的服务器会在返回错误之前再次停止，因此启动要么使所有
+    服务器运行，要么一个都不留。所有服务器的错误通过errors.Join合并。
+*/
+type ServerGroup struct {
+    logger *LeveledLogger
+    order  *HookOrder
+
+    mu      sync.Mutex
+    servers []groupedServer
+}
+
+type groupedServer struct {
+    label  string
+    server *http.Server
+    hook   fx.Hook
+}
+
+// NewServerGroup constructs an empty ServerGroup.
+func NewServerGroup(logger *LeveledLogger, order *HookOrder) *ServerGroup {
+    return &ServerGroup{logger: logger, order: order}
+}
+
+// add puts server, labelled label, in the group, with hook to start and stop
+// it. The first call registers the group's own hook on lc, which puts it at
+// the first server's position in the dependency order.
+func (g *ServerGroup) add(lc fx.Lifecycle, label string, server *http.Server, hook fx.Hook) {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    if len(g.servers) == 0 {
+        lc.Append(fx.Hook{OnStart: g.start, OnStop: g.stop})
+    }
+    g.servers = append(g.servers, groupedServer{label, server, hook})
+}
+
+// Servers returns the servers in the group, in the order they were added.
+func (g *ServerGroup) Servers() []*http.Server {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    servers := make([]*http.Server, len(g.servers))
+    for i, s := range g.servers {
+        servers[i] = s.server
+    }
+    return servers
+}
+
+func (g *ServerGroup) members() []groupedServer {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    return append([]groupedServer(nil), g.servers...)
+}
+
+func (g *ServerGroup) start(ctx context.Context) error {
+    servers := g.members()
+    g.logger.Debugf("OnStart #%d: HTTP servers.", g.order.Start("HTTP servers"))
+    g.logger.Infof("Starting %d HTTP server(s).", len(servers))
+    errs := runConcurrently(servers, func(s groupedServer) error { return s.hook.OnStart(ctx) })
+
+    var started, failed []groupedServer
+    for i, err := range errs {
+        if err != nil {
+            failed = append(failed, servers[i])
+        } else {
+            started = append(started, servers[i])
+        }
+    }
+    if len(failed) == 0 {
+        g.logger.Infof("Started %d HTTP server(s).", len(servers))
+        return nil
+    }
+    // Fx won't run our OnStop when OnStart fails, so stop what did start.
+    // OnStart失败时Fx不会运行我们的OnStop，因此由我们停止已经启动的服务器。
+    g.logger.Errorf("%d of %d HTTP server(s) failed to start; stopping the other %d.",
+        len(failed), len(servers), len(started))
+    errs = append(errs, runConcurrently(started, func(s groupedServer) error { return s.hook.OnStop(ctx) })...)
+    return errors.Join(errs...)
+}
+
+func (g *ServerGroup) stop(ctx context.Context) error {
+    servers := g.members()
+    g.logger.Debugf("OnStop #%d: HTTP servers.", g.order.Stop("HTTP servers"))
+    g.logger.Infof("Stopping %d HTTP server(s).", len(servers))
+    err := errors.Join(runConcurrently(servers, func(s groupedServer) error { return s.hook.OnStop(ctx) })...)
+    if err == nil {
+        g.logger.Infof("Stopped %d HTTP server(s).", len(servers))
+    }
+    return err
+}
+
+// runConcurrently calls f for each server at once, returning their errors in
+// the same order as servers.
+func runConcurrently(servers []groupedServer, f func(groupedServer) error) []error {
+    errs := make([]error, len(servers))
+    var wg sync.WaitGroup
+    for i, s := range servers {
+        wg.Add(1)
+        go func(i int, s groupedServer) {
+            defer wg.Done()
+            errs[i] = f(s)
+        }(i, s)
+    }
+    wg.Wait()
+    return errs
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+    "context"
+    "os"
+    "os/signal"
+    "syscall"
+
+    "go.uber.org/fx"
+)
+
+// SignalParams are NewSignalHandler's dependencies.
+type SignalParams struct {
+    fx.In
+
+    Lifecycle  fx.Lifecycle
+    Context    context.Context
+    Shutdowner fx.Shutdowner
+    Live       *LiveConfig
+    Hooks      *ReloadHooks
+    Logger     *LeveledLogger
+}
+
+// SignalHandler maps process signals to lifecycle actions, all in one place:
+//
+//   - SIGINT and SIGTERM shut the application down through fx.Shutdowner,
+//     which unblocks app.Done() in main;
+//   - SIGHUP reloads the configuration, applying the hot-reloadable settings
+//     (see reloadConfig), and then everything registered with ReloadHooks,
+//     such as TLS certificates;
+//   - SIGUSR1 toggles DEBUG logging on and off, for a look at a running
+//     process without a restart.
+//
+// It's started by an invocation main adds, rather than by HTTPModule, so
+// tests built from the module never install a signal handler.
+/*
+    SignalHandler 将进程信号集中映射为生命周期操作：
+
+      - SIGINT和SIGTERM通过fx.Shutdowner关闭应用程序，从而解除main中app.Done()的阻塞；
+      - SIGHUP重新加载配置，应用可热重载的设置（参见reloadConfig），随后重新加载注册到
+        ReloadHooks的所有内容，例如TLS证书；
+      - SIGUSR1开启或关闭DEBUG日志，便于在不重启的情况下查看运行中的进程。
+
+    它由main添加的invocation启动，而不是由HTTPModule启动，因此基于该模块构建的测试永远
+    不会安装信号处理器。
+*/
+type SignalHandler struct {
+    p       SignalParams
+    signals chan os.Signal
+    done    chan struct{}
+}
+
+// NewSignalHandler constructs the SignalHandler. Its OnStart hook starts
+// listening for signals and its OnStop hook stops, handing them back to the
+// runtime's defaults.
+func NewSignalHandler(p SignalParams) *SignalHandler {
+    h := &SignalHandler{p: p, signals: make(chan os.Signal, 1), done: make(chan struct{})}
+    p.Lifecycle.Append(fx.Hook{
+        OnStart: func(context.Context) error {
+            signal.Notify(h.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+            go h.run()
+            return nil
+        },
+        OnStop: func(context.Context) error {
+            signal.Stop(h.signals)
+            close(h.done)
+            return nil
+        },
+    })
+    return h
+}
+
+func (h *SignalHandler) run() {
+    logger := h.p.Logger
+    for {
+        select {
+        case sig := <-h.signals:
+            switch sig {
+            case syscall.SIGINT, syscall.SIGTERM:
+                logger.Infof("Received %s, shutting down.", sig)
+                if err := h.p.Shutdowner.Shutdown(); err != nil {
+                    logger.Errorf("Shutting down: %v", err)
+                }
+            case syscall.SIGHUP:
+                reloadConfig(h.p.Live, logger)
+                h.p.Hooks.run(logger)
+            case syscall.SIGUSR1:
+                h.toggleDebug()
+            }
+        case <-h.done:
+            return
+        case <-h.p.Context.Done():
+            return
+        }
+    }
+}
+
+// toggleDebug switches the log level to DEBUG, or back to the configured
+// level if it's DEBUG already.
+func (h *SignalHandler) toggleDebug() {
+    logger := h.p.Logger
+    level := LevelDebug
+    if logger.Level() == LevelDebug {
+        if level = h.p.Live.Load().Log.Level; level == LevelDebug {
+            level = LevelInfo
+        }
+    }
+    logger.SetLevel(level)
+    // Log at WARN, so the line shows whichever way we went.
+    logger.Warnf("Received SIGUSR1, log level is now %s.", level)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "net/http"
+    "strings"
+)
+
+// Trailing slash modes understood by MiddlewareConfig.TrailingSlash.
+const (
+    TrailingSlashOff    = "off"
+    TrailingSlashStrip  = "strip"
+    TrailingSlashAppend = "append"
+)
+
+// trailingSlash redirects requests for path to its canonical form: without a
+// trailing slash in TrailingSlashStrip mode, with one in TrailingSlashAppend
+// mode. route is the pattern the request was routed by. A request for exactly
+// a subtree pattern such as "/static/" is never redirected, which keeps it
+// from bouncing back and forth with ServeMux, which itself redirects
+// "/static" there.
+//
+// GET and HEAD requests get a 301. Other methods get a 308, which tells
+// clients to repeat the request with the same method and body.
+func trailingSlash(next http.Handler, mode, route string) http.Handler {
+    if mode != TrailingSlashStrip && mode != TrailingSlashAppend {
+        return next
+    }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        path := r.URL.Path
+        target := path
+        switch {
+        case strings.HasSuffix(route, "/") && path == route || path == "/":
+        case mode == TrailingSlashStrip && strings.HasSuffix(path, "/"):
+            if target = strings.TrimRight(path, "/"); target == "" {
+                target = "/"
+            }
+        case mode == TrailingSlashAppend && !strings.HasSuffix(path, "/"):
+            target = path + "/"
+        }
+        if target == path {
+            next.ServeHTTP(w, r)
+            return
+        }
+        u := *r.URL
+        u.Path = target
+        u.RawPath = ""
+        code := http.StatusMovedPermanently
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+            code = http.StatusPermanentRedirect
+        }
+        http.Redirect(w, r, u.RequestURI(), code)
+    })
+}
+
+// slashAlias returns the pattern to register alongside path so that requests
+// for its other form reach trailingSlash and get redirected, rather than
+// falling through to "/" or a 404: path + "/{$}", which matches path with a
+// trailing slash and nothing below it. It's empty when mode leaves paths
+// alone or path already ends in "/".
+func slashAlias(path, mode string) string {
+    if mode != TrailingSlashStrip && mode != TrailingSlashAppend || strings.HasSuffix(path, "/") {
+        return ""
+    }
+    return path + "/{$}"
+}
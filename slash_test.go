@@ -0,0 +1,48 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+)
+
+func TestTrailingSlashStrip(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) { c.Middleware.TrailingSlash = TrailingSlashStrip }).start()
+
+    resp, _ := app.get("/healthz/")
+    if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/healthz" {
+        t.Errorf("GET /healthz/ = %s to %q, want 301 to /healthz", resp.Status, resp.Header.Get("Location"))
+    }
+    if resp, _ := app.get("/healthz"); resp.StatusCode != http.StatusOK {
+        t.Errorf("GET /healthz = %s, want 200", resp.Status)
+    }
+    resp, _ = app.do(http.MethodPost, "/echo/", nil)
+    if resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != "/echo" {
+        t.Errorf("POST /echo/ = %s to %q, want 308 to /echo", resp.Status, resp.Header.Get("Location"))
+    }
+}
+
+func TestTrailingSlashAppend(t *testing.T) {
+    app := newTestApp(t, func(c *AppConfig) { c.Middleware.TrailingSlash = TrailingSlashAppend }).start()
+
+    resp, _ := app.get("/healthz?verbose=1")
+    if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/healthz/?verbose=1" {
+        t.Errorf("GET /healthz = %s to %q, want 301 to /healthz/?verbose=1", resp.Status, resp.Header.Get("Location"))
+    }
+    // The health check answers with an empty body, unlike the catch-all
+    // "/" route "/healthz/" would otherwise fall through to.
+    if resp, body := app.get("/healthz/"); resp.StatusCode != http.StatusOK || body != "" {
+        t.Errorf("GET /healthz/ = %s %q, want the health check's empty 200", resp.Status, body)
+    }
+    // "/" is its own canonical form.
+    if resp, _ := app.get("/"); resp.StatusCode != http.StatusOK {
+        t.Errorf("GET / = %s, want 200", resp.Status)
+    }
+}
+
+func TestTrailingSlashOff(t *testing.T) {
+    app := newTestApp(t, nil).start()
+
+    if resp, body := app.get("/healthz/"); resp.StatusCode == http.StatusMovedPermanently {
+        t.Errorf("GET /healthz/ = %s %q, want no redirect with trailing slashes off", resp.Status, body)
+    }
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "net"
+    "os"
+)
+
+// Networks understood by ServerConfig.Network.
+const (
+    NetworkTCP  = "tcp"
+    NetworkTCP4 = "tcp4"
+    NetworkTCP6 = "tcp6"
+    NetworkUnix = "unix"
+)
+
+// socketMode is the permission set on Unix sockets: the owner and group can
+// connect, nobody else can.
+const socketMode = 0o660
+
+// listenUnix listens on the Unix socket at path with listen, first removing
+// a socket file left behind by a previous run that didn't shut down cleanly,
+// and restricts who may connect to it.
+func listenUnix(listen ListenFunc, path string) (net.Listener, error) {
+    if path == "" {
+        return nil, errors.New("a socket path is required to listen on a Unix socket")
+    }
+    if err := removeSocket(path); err != nil {
+        return nil, err
+    }
+    ln, err := listen(NetworkUnix, path)
+    if err != nil {
+        return nil, err
+    }
+    if err := os.Chmod(path, socketMode); err != nil {
+        ln.Close()
+        return nil, fmt.Errorf("setting permissions on %s: %w", path, err)
+    }
+    return ln, nil
+}
+
+// reusePortListen is a ListenFunc that sets SO_REUSEPORT on the socket, so
+// that another process can bind the same address while this one is still
+// listening on it.
+func reusePortListen(network, addr string) (net.Listener, error) {
+    lc := net.ListenConfig{Control: reusePortControl}
+    return lc.Listen(context.Background(), network, addr)
+}
+
+// removeSocket unlinks the Unix socket at path, if there is one. It refuses
+// to remove anything that isn't a socket, so a misconfigured path can't
+// delete an unrelated file.
+func removeSocket(path string) error {
+    fi, err := os.Lstat(path)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    if fi.Mode().Type() != fs.ModeSocket {
+        return fmt.Errorf("%s exists and is not a socket", path)
+    }
+    return os.Remove(path)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "os"
+    "path"
+    "strings"
+)
+
+// StaticPrefix is the path NewStaticHandler mounts AppConfig.StaticDir on.
+const StaticPrefix = "/static/"
+
+// NewStaticHandler constructs a route serving the files in AppConfig.StaticDir
+// under /static/, so a small web UI can live alongside the API. When no
+// directory is configured it returns no route at all; when the directory
+// isn't there, an error. It's provided through OptionalRoute as "static", so
+// that error only skips the route, unless MiddlewareConfig.RequiredRoutes
+// lists it.
+/*
+    NewStaticHandler 构造一个在/static/下提供AppConfig.StaticDir中文件的路由，这样一个
+    小型的Web UI可以与API并存。未配置目录时，它不返回任何路由；目录不存在时返回错误。它
+    通过OptionalRoute以"static"之名提供，因此该错误只会略过该路由，除非
+    MiddlewareConfig.RequiredRoutes列出了它。
+*/
+func NewStaticHandler(cfg AppConfig) (Route, error) {
+    if cfg.StaticDir == "" {
+        return Route{}, nil
+    }
+    if info, err := os.Stat(cfg.StaticDir); err != nil {
+        return Route{}, fmt.Errorf("static_dir: %w", err)
+    } else if !info.IsDir() {
+        return Route{}, fmt.Errorf("static_dir: %s is not a directory", cfg.StaticDir)
+    }
+    files := http.FileServer(http.Dir(cfg.StaticDir))
+    return Route{
+        Path: StaticPrefix,
+        Handler: http.StripPrefix(strings.TrimSuffix(StaticPrefix, "/"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            // http.Dir already refuses to leave its root, but clean the path
+            // ourselves too so "../" can never reach the file system.
+            // Keep a trailing slash, or FileServer would redirect forever.
+            cleaned := path.Clean("/" + r.URL.Path)
+            if strings.HasSuffix(r.URL.Path, "/") && cleaned != "/" {
+                cleaned += "/"
+            }
+            r.URL.Path = cleaned
+            files.ServeHTTP(w, r)
+        })),
+    }, nil
+}
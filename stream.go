@@ -0,0 +1,87 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+)
+
+// streamInterval is how often the /stream route sends an event.
+const streamInterval = time.Second
+
+// streamWriteTimeout bounds each event's write, in place of the server's
+// WriteTimeout, which would otherwise end the whole stream.
+const streamWriteTimeout = 10 * time.Second
+
+// NewStreamHandler constructs GET /stream, which demonstrates streaming
+// responses: it sends a server-sent event every second, flushing each one to
+// the client as it's written, until the client disconnects or the server
+// shuts down. Events are timed by clock, so a test can step through them with
+// a FakeClock. Both end the request's context - the first by net/http, the
+// second because NewMux cancels request contexts when it stops - so the
+// handler just watches ctx.Done().
+//
+// http.TimeoutHandler buffers the whole response and can't flush, so the
+// route opts out of the request timeout. ServerConfig.WriteTimeout is a
+// deadline on the connection, set when the request arrives, so the handler
+// moves it forward before each event, as net/http/pprof does for long
+// profiles: a client that stops reading is still cut off, but one that keeps
+// up can stream for as long as it likes.
+/*
+    NewStreamHandler 构造GET /stream，用于演示流式响应：它每秒发送一个server-sent
+    event，每写一个就刷新给客户端，直到客户端断开连接或服务器关闭。事件由clock计时，
+    因此测试可以用FakeClock逐个推进。两者都会结束请求的
+    context（前者由net/http完成，后者是因为NewMux在停止时会取消请求context），因此
+    handler只需关注ctx.Done()。
+
+    http.TimeoutHandler会缓冲整个响应且无法刷新，因此该路由不受请求超时的限制。
+    ServerConfig.WriteTimeout是在请求到达时设置的连接截止时间，因此handler在每个事件
+    之前将其后移，就像net/http/pprof处理长时间profile那样：停止读取的客户端仍会被切断，
+    而跟得上的客户端可以无限期地接收流。
+*/
+func NewStreamHandler(logger *LeveledLogger, clock Clock) RouteResult {
+    h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        flusher, ok := w.(http.Flusher)
+        if !ok {
+            WriteProblem(w, http.StatusInternalServerError, "", "streaming is not supported")
+            return
+        }
+        rc := http.NewResponseController(w)
+        extend := func() {
+            // Not every writer supports deadlines (a test recorder, say);
+            // without one, WriteTimeout applies as usual.
+            if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+                logger.Debugf("Extending the stream's write deadline: %v", err)
+            }
+        }
+        extend()
+        w.Header().Set("Content-Type", "text/event-stream")
+        w.Header().Set("Cache-Control", "no-cache")
+        w.WriteHeader(http.StatusOK)
+        flusher.Flush()
+
+        ticker := clock.NewTicker(streamInterval)
+        defer ticker.Stop()
+        for id := 1; ; id++ {
+            select {
+            case <-ticker.C():
+                extend()
+                if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, clock.Now().UTC().Format(time.RFC3339)); err != nil {
+                    logger.Debugf("Stream ended: %v", err)
+                    return
+                }
+                flusher.Flush()
+            case <-r.Context().Done():
+                logger.Debugf("Stream ended after %d events: %v", id-1, r.Context().Err())
+                return
+            }
+        }
+    })
+    return RouteResult{Route: Route{
+        Path:      "/stream",
+        Method:    http.MethodGet,
+        Handler:   h,
+        NoTimeout: true,
+    }}
+}
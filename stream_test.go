@@ -0,0 +1,68 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "go.uber.org/fx"
+)
+
+// waitForTickers waits until clock has n tickers running.
+func waitForTickers(t *testing.T, clock *FakeClock, n int) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for clock.Tickers() != n {
+        if time.Now().After(deadline) {
+            t.Fatalf("%d ticker(s) running, want %d", clock.Tickers(), n)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestStreamSendsEventsUntilClientLeaves(t *testing.T) {
+    clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+    app := newTestApp(t, nil, fx.Decorate(func(Clock) Clock { return clock })).start()
+    // Background sweeps have their tickers by now; the stream adds one.
+    sweeps := clock.Tickers()
+
+    resp, err := http.Get(app.URL() + "/stream")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+        t.Fatalf("GET /stream = %s %q, want 200 text/event-stream", resp.Status, ct)
+    }
+    waitForTickers(t, clock, sweeps+1)
+
+    events := bufio.NewReader(resp.Body)
+    for id := 1; id <= 3; id++ {
+        clock.Advance(streamInterval)
+        want := fmt.Sprintf("id: %d\ndata: %s\n\n", id, clock.Now().Format(time.RFC3339))
+        var got strings.Builder
+        for !strings.HasSuffix(got.String(), "\n\n") {
+            line, err := events.ReadString('\n')
+            if err != nil {
+                t.Fatalf("reading event %d: %v", id, err)
+            }
+            got.WriteString(line)
+        }
+        if got.String() != want {
+            t.Errorf("event %d = %q, want %q", id, got.String(), want)
+        }
+    }
+
+    resp.Body.Close()
+    waitForTickers(t, clock, sweeps)
+    deadline := time.Now().Add(5 * time.Second)
+    for !strings.Contains(app.logs.String(), "Stream ended after 3 events") {
+        if time.Now().After(deadline) {
+            t.Fatalf("log doesn't mention the stream ending:\n%s", app.logs.String())
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+    "go.opentelemetry.io/otel/propagation"
+    "go.opentelemetry.io/otel/sdk/resource"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+    "go.opentelemetry.io/otel/trace/noop"
+    "go.uber.org/fx"
+)
+
+// DefaultServiceName identifies this application's spans when TracingConfig
+// doesn't name it.
+const DefaultServiceName = "inject"
+
+// tracerName names the tracer the middleware and the HTTP client take from
+// the TracerProvider.
+const tracerName = "github.com/wenzhenxiang/inject"
+
+// TracingConfig holds the OpenTelemetry settings. An empty Endpoint disables
+// tracing: NewTracerProvider returns a no-op provider, so the tracing
+// middleware costs next to nothing.
+/*
+    TracingConfig 保存OpenTelemetry的设置。Endpoint为空时禁用追踪：NewTracerProvider
+    返回一个no-op provider，因此追踪中间件几乎没有开销。
+*/
+type TracingConfig struct {
+    // Endpoint is the host:port of the OTLP/HTTP collector spans are
+    // exported to, e.g. "localhost:4318".
+    Endpoint string `yaml:"endpoint"`
+    // Insecure exports over plain HTTP rather than HTTPS.
+    Insecure bool `yaml:"insecure"`
+    // ServiceName is recorded on every span. Defaults to DefaultServiceName.
+    ServiceName string `yaml:"service_name"`
+}
+
+func (c TracingConfig) serviceName() string {
+    if c.ServiceName == "" {
+        return DefaultServiceName
+    }
+    return c.ServiceName
+}
+
+// TracingModule adds distributed tracing to an application built with
+// HTTPModule: a TracerProvider, and a middleware that continues the trace
+// described by each incoming request's W3C traceparent header (or starts a
+// new one) with a server span named after the method and route pattern. The
+// span's context is the request's context, and with a TracerProvider in the
+// graph NewHTTPClient sends it on in each outbound call's traceparent header,
+// so the trace follows the request to other services.
+//
+// It's a module of its own rather than part of HTTPModule so that
+// applications - and tests - that don't want tracing can leave it out
+// entirely.
+/*
+    TracingModule 为使用HTTPModule构建的应用程序添加分布式追踪：一个TracerProvider，以及
+    一个中间件，它延续每个传入请求的W3C traceparent头所描述的trace（或开始一个新的），
+    并创建以方法和路由模式命名的服务端span。span的context就是请求的context；依赖图中有
+    TracerProvider时，NewHTTPClient会在每个出站调用的traceparent头中继续传递它，因此
+    trace会跟随请求进入其他服务。
+
+    它是一个独立的模块而不是HTTPModule的一部分，这样不需要追踪的应用程序（以及测试）
+    可以完全不包含它。
+*/
+var TracingModule = fx.Module("tracing",
+    fx.Provide(
+        NewTracerProvider,
+        NewTracingMiddleware,
+    ),
+)
+
+// NewTracerProvider constructs the TracerProvider: one exporting to
+// cfg.Endpoint over OTLP/HTTP, or a no-op provider when no endpoint is
+// configured. Spans are batched, and the OnStop hook flushes whatever is
+// still buffered before the application exits.
+/*
+    NewTracerProvider 构造TracerProvider：通过OTLP/HTTP导出到cfg.Endpoint，或者在未配置
+    endpoint时使用no-op provider。span会被批量导出，OnStop hook会在应用程序退出前刷新
+    仍在缓冲中的内容。
+*/
+func NewTracerProvider(lc fx.Lifecycle, cfg TracingConfig, logger *LeveledLogger) (trace.TracerProvider, error) {
+    if cfg.Endpoint == "" {
+        return noop.NewTracerProvider(), nil
+    }
+    opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+    if cfg.Insecure {
+        opts = append(opts, otlptracehttp.WithInsecure())
+    }
+    // The exporter doesn't connect until it has spans to send, so this
+    // context only bounds its setup.
+    exporter, err := otlptracehttp.New(context.Background(), opts...)
+    if err != nil {
+        return nil, fmt.Errorf("creating trace exporter for %s: %w", cfg.Endpoint, err)
+    }
+    tp := sdktrace.NewTracerProvider(
+        sdktrace.WithBatcher(exporter),
+        sdktrace.WithResource(resource.NewSchemaless(
+            attribute.String("service.name", cfg.serviceName()),
+        )),
+    )
+    lc.Append(fx.Hook{
+        OnStart: func(context.Context) error {
+            logger.Infof("Exporting traces to %s.", cfg.Endpoint)
+            return nil
+        },
+        OnStop: func(ctx context.Context) error {
+            logger.Info("Flushing traces.")
+            return tp.Shutdown(ctx)
+        },
+    })
+    return tp, nil
+}
+
+// NewTracingMiddleware contributes the tracing middleware.
+func NewTracingMiddleware(tp trace.TracerProvider) MiddlewareResult {
+    tracer := tp.Tracer(tracerName)
+    return MiddlewareResult{Middleware: Middleware{
+        Name:     "tracing",
+        Priority: PriorityTracing,
+        Wrap:     func(next http.Handler) http.Handler { return traceRequests(next, tracer) },
+    }}
+}
+
+// traceRequests runs each request to next in a server span, parented by the
+// trace context in the request's traceparent header if there is one. The span
+// is named after the pattern the request was routed by, not its path, so
+// "/users/{id}" is one span name rather than one per user.
+func traceRequests(next http.Handler, tracer trace.Tracer) http.Handler {
+    var propagator propagation.TraceContext
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+        name := r.Method
+        if r.Pattern != "" {
+            name += " " + r.Pattern
+        }
+        ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+        defer span.End()
+
+        rec := newStatusRecorder(w)
+        next.ServeHTTP(rec, r.WithContext(ctx))
+
+        span.SetAttributes(
+            attribute.String("http.request.method", r.Method),
+            attribute.String("http.route", r.Pattern),
+            attribute.String("url.path", r.URL.Path),
+            attribute.Int("http.response.status_code", rec.Status),
+        )
+        if rec.Status >= http.StatusInternalServerError {
+            span.SetStatus(codes.Error, http.StatusText(rec.Status))
+        }
+    })
+}
+
+// traceCalls runs each outbound call through next in a client span, a child
+// of whatever span the request's context carries, and injects the span's
+// trace context into the call's traceparent header for the server on the
+// other end to continue.
+func traceCalls(next http.RoundTripper, tracer trace.Tracer) http.RoundTripper {
+    return tracingTransport{tracer, next}
+}
+
+type tracingTransport struct {
+    tracer trace.Tracer
+    next   http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    ctx, span := t.tracer.Start(req.Context(), req.Method, trace.WithSpanKind(trace.SpanKindClient))
+    defer span.End()
+    // A RoundTripper mustn't modify the request it's given.
+    req = req.Clone(ctx)
+    propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+    span.SetAttributes(
+        attribute.String("http.request.method", req.Method),
+        attribute.String("url.full", req.URL.Redacted()),
+    )
+    resp, err := t.next.RoundTrip(req)
+    if err != nil {
+        span.SetStatus(codes.Error, err.Error())
+        return nil, err
+    }
+    span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+    if resp.StatusCode >= http.StatusInternalServerError {
+        span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+    }
+    return resp, nil
+}
+
+// CloseIdleConnections passes through to next, as breakerTransport's does.
+func (t tracingTransport) CloseIdleConnections() {
+    if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+        c.CloseIdleConnections()
+    }
+}
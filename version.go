@@ -0,0 +1,58 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "runtime"
+)
+
+// Build information, set at link time:
+//
+//   go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+//
+// Each is "dev" in builds that don't set it.
+var (
+    version   = "dev"
+    commit    = "dev"
+    buildTime = "dev"
+)
+
+// BuildInfo identifies the running binary.
+/*
+    BuildInfo 标识正在运行的二进制文件。
+*/
+type BuildInfo struct {
+    Version   string `json:"version"`
+    Commit    string `json:"commit"`
+    BuildTime string `json:"build_time"`
+    GoVersion string `json:"go_version"`
+}
+
+// NewBuildInfo provides the BuildInfo stamped into the binary with -ldflags
+// (see version above), so handlers and the startup banner can report which
+// build is deployed.
+/*
+    NewBuildInfo 提供通过-ldflags写入二进制文件的BuildInfo（参见上面的version），以便
+    handlers和启动banner能够报告部署的是哪个构建。
+*/
+func NewBuildInfo() BuildInfo {
+    return BuildInfo{
+        Version:   version,
+        Commit:    commit,
+        BuildTime: buildTime,
+        GoVersion: runtime.Version(),
+    }
+}
+
+// NewVersionHandler constructs the GET /version route, serving the BuildInfo
+// as JSON.
+func NewVersionHandler(info BuildInfo) RouteResult {
+    return RouteResult{Route: Route{
+        Path:   "/version",
+        Method: http.MethodGet,
+        Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+            w.Header().Set("Content-Type", "application/json")
+            json.NewEncoder(w).Encode(info)
+        }),
+    }}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "sync"
+
+    "go.uber.org/fx"
+)
+
+// DefaultWorkers is the WorkerPool size used when AppConfig.Workers is unset.
+const DefaultWorkers = 4
+
+// Errors returned by WorkerPool.Submit.
+var (
+    ErrPoolNotStarted = errors.New("worker pool has not started")
+    ErrPoolClosed     = errors.New("worker pool is closed")
+)
+
+// WorkerPool runs submitted functions on a fixed number of goroutines. It's
+// the Lifecycle pattern applied to background work rather than a server: the
+// workers start in OnStart, and OnStop stops accepting work and waits for the
+// queue to drain.
+/*
+    WorkerPool 在固定数量的goroutine上运行提交的函数。它是将Lifecycle模式应用于后台
+    工作而不是服务器：worker在OnStart中启动，OnStop停止接受新工作并等待队列排空。
+*/
+type WorkerPool struct {
+    ctx   context.Context
+    size  int
+    tasks chan func()
+    wg    sync.WaitGroup
+    // done is closed when stop begins, releasing Submit calls blocked on a
+    // full queue so stop can take the lock.
+    done chan struct{}
+
+    mu      sync.RWMutex
+    running bool
+    closed  bool
+}
+
+// NewWorkerPool constructs a pool of AppConfig.Workers goroutines. Submit
+// gives up once ctx, the application context, is cancelled.
+func NewWorkerPool(lc fx.Lifecycle, ctx context.Context, cfg AppConfig, logger *LeveledLogger) *WorkerPool {
+    size := cfg.Workers
+    if size <= 0 {
+        size = DefaultWorkers
+    }
+    p := &WorkerPool{
+        ctx:   ctx,
+        size:  size,
+        tasks: make(chan func(), size),
+        done:  make(chan struct{}),
+    }
+    lc.Append(fx.Hook{
+        OnStart: func(context.Context) error {
+            logger.Infof("Starting %d workers.", p.size)
+            p.start()
+            return nil
+        },
+        OnStop: func(ctx context.Context) error {
+            logger.Info("Stopping workers.")
+            return p.stop(ctx)
+        },
+    })
+    return p
+}
+
+// Submit queues task to run on one of the workers. It blocks while the queue
+// is full, and returns an error instead of blocking forever once the pool
+// starts stopping.
+func (p *WorkerPool) Submit(task func()) error {
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    switch {
+    case p.closed:
+        return ErrPoolClosed
+    case !p.running:
+        return ErrPoolNotStarted
+    }
+    select {
+    case p.tasks <- task:
+        return nil
+    case <-p.done:
+        return ErrPoolClosed
+    case <-p.ctx.Done():
+        return ErrPoolClosed
+    }
+}
+
+func (p *WorkerPool) start() {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    p.running = true
+    for i := 0; i < p.size; i++ {
+        p.wg.Add(1)
+        go func() {
+            defer p.wg.Done()
+            for task := range p.tasks {
+                task()
+            }
+        }()
+    }
+}
+
+// stop closes the queue to new work and waits, until ctx is done, for the
+// workers to finish what's already queued.
+func (p *WorkerPool) stop(ctx context.Context) error {
+    // Submit holds the read lock while it waits for room in the queue, so
+    // wake it before taking the write lock.
+    close(p.done)
+    p.mu.Lock()
+    p.closed = true
+    close(p.tasks)
+    p.mu.Unlock()
+
+    done := make(chan struct{})
+    go func() {
+        p.wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "go.uber.org/fx/fxtest"
+)
+
+func TestWorkerPoolStopWithFullQueue(t *testing.T) {
+    cfg := NewAppConfig()
+    cfg.Workers = 1
+    lc := fxtest.NewLifecycle(t)
+    p := NewWorkerPool(lc, t.Context(), cfg, discardLogger())
+    lc.RequireStart()
+
+    release := make(chan struct{})
+    defer close(release)
+    running := make(chan struct{})
+    // One task occupies the only worker and another fills the queue, so the
+    // next Submit blocks.
+    if err := p.Submit(func() { close(running); <-release }); err != nil {
+        t.Fatal(err)
+    }
+    <-running
+    if err := p.Submit(func() {}); err != nil {
+        t.Fatal(err)
+    }
+    submitted := make(chan error, 1)
+    go func() { submitted <- p.Submit(func() {}) }()
+    select {
+    case err := <-submitted:
+        t.Fatalf("Submit on a full queue returned %v without blocking", err)
+    case <-time.After(20 * time.Millisecond):
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    stopped := make(chan error, 1)
+    go func() { stopped <- p.stop(ctx) }()
+    select {
+    case err := <-stopped:
+        if !errors.Is(err, context.DeadlineExceeded) {
+            t.Errorf("stop with a stuck worker = %v, want %v", err, context.DeadlineExceeded)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("stop hung past its deadline")
+    }
+    if err := <-submitted; !errors.Is(err, ErrPoolClosed) {
+        t.Errorf("blocked Submit = %v, want %v", err, ErrPoolClosed)
+    }
+}